@@ -5,8 +5,10 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"gioui.org/app"
+	"gioui.org/io/key"
 	"gioui.org/layout"
 	"gioui.org/op"
 	"gioui.org/op/paint"
@@ -38,13 +40,14 @@ type appState struct {
 	sidebar *sidebar.Sidebar
 	split   *split.Split
 	tree    *treeview.Tree
+	outline outlinePanel
 
 	theme     *theme.Theme
 	tabitems  *tabs.Tabs
 	actionbar *actionbar.ActionBar
 	appBar    *actionbar.ActionBar
 
-	openFiles     map[string]fileView
+	openFiles     map[string]*fileView
 	openTabs      map[string]*tabs.Tab
 	openPaths     []string             // path order matching tab order
 	tabToPath     map[*tabs.Tab]string // tab -> path for close callback
@@ -52,6 +55,22 @@ type appState struct {
 	pendingDiag   map[string][]protocol.Diagnostic // path -> diagnostics to apply (set by LSP callback)
 	pendingDiagMu sync.Mutex
 	currentDiag   map[string][]protocol.Diagnostic // path -> last applied diagnostics (for hover tooltip)
+
+	window    *app.Window
+	uiQueue   []func() // work posted from LSP goroutines, run on the UI goroutine (see runOnUI)
+	uiQueueMu sync.Mutex
+
+	picker        picker // modal list, e.g. to choose between several definitions
+	focusEditor   bool   // give keyboard focus to the current editor on the next frame
+	references    referencesPanel
+	hierarchy     hierarchyPanel
+	rename        renameDialog
+	symbolSearch  symbolSearch
+	notifications notifications
+	// completionHistory is shared by the editors' completion rankers.
+	completionHistory lsp.CompletionHistory
+	userSnippets      userSnippets
+	workspaceIndex    workspaceIndex // identifiers of the project, for files without a server
 }
 
 // fileView represents an open file in the editor.
@@ -66,6 +85,7 @@ type fileView struct {
 	LSPClient  *lsp.Client
 	LSPDocURI  string
 	DocVersion int32
+	lspText    string // text the server last saw (didOpen/didChange), see syncLSP
 }
 
 // newAppState creates and initializes the application state.
@@ -88,14 +108,18 @@ func newAppState() *appState {
 		actionbar: actionbar.NewActionBar(layout.Horizontal, layout.Start, layout.SpaceAround),
 		appBar:    actionbar.NewActionBar(layout.Horizontal, layout.Start, layout.SpaceBetween),
 		theme:     th,
-		openFiles: make(map[string]fileView),
+		openFiles: make(map[string]*fileView),
 		openTabs:  make(map[string]*tabs.Tab),
 		openPaths: make([]string, 0),
 		tabToPath: make(map[*tabs.Tab]string),
 	}
 	state.tree = state.buildFileTree(th)
 	state.tabitems = tabs.NewTabs()
+	state.workspaceIndex.build(".")
+	state.userSnippets.load(state, ".")
 	state.lspManager = lsp.NewManager(lsp.LoadConfig("."))
+	state.lspManager.SetApplyEditHandler(state.applyServerEdit)
+	state.lspManager.SetNotifyHandler(state.notify)
 	state.pendingDiag = make(map[string][]protocol.Diagnostic)
 	state.currentDiag = make(map[string][]protocol.Diagnostic)
 
@@ -112,6 +136,7 @@ func newAppState() *appState {
 
 	// Sidebar nav
 	state.sidebar.AddNavItem(sidebar.Item{Tag: "files", Name: "Files", Icon: icons.Files})
+	state.sidebar.AddNavItem(sidebar.Item{Tag: "outline", Name: "Outline", Icon: outlineIcon})
 	state.sidebar.AddNavItem(sidebar.Item{Tag: "setting", Name: "Setting", Icon: icons.Settings})
 
 	return state
@@ -120,6 +145,7 @@ func newAppState() *appState {
 // appLayout renders the main application layout.
 func (s *appState) appLayout(gtx layout.Context) {
 	th := s.theme
+	s.drainUIQueue()
 	paint.Fill(gtx.Ops, th.Base.Surface)
 
 	layout.Flex{Axis: layout.Vertical}.Layout(gtx,
@@ -162,6 +188,9 @@ func (s *appState) layoutLeftPanel(gtx layout.Context) layout.Dimensions {
 			if s.NewFileClickable.Clicked(gtx) {
 				s.openNewFile()
 			}
+			if s.SearchClickable.Clicked(gtx) {
+				s.symbolSearch.open()
+			}
 			return layout.UniformInset(unit.Dp(8)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 				return s.actionbar.Layout(gtx, s.theme)
 			})
@@ -170,26 +199,63 @@ func (s *appState) layoutLeftPanel(gtx layout.Context) layout.Dimensions {
 			return divider.NewDivider(layout.Horizontal, unit.Dp(1), s.theme.Base.SurfaceHighlight).Layout(gtx, s.theme)
 		}),
 		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			if s.sidebar.Current() == "outline" {
+				return s.layoutOutline(gtx)
+			}
 			return s.tree.Layout(gtx, s.theme)
 		}),
 	)
 }
 
 func (s *appState) layoutRightPanel(gtx layout.Context) layout.Dimensions {
-	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
-		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-			return s.tabitems.Layout(gtx, s.theme)
+	if s.picker.closed || s.rename.closed || s.symbolSearch.closed {
+		s.picker.closed, s.rename.closed, s.symbolSearch.closed = false, false, false
+		s.focusEditor = true
+	}
+	return layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return s.tabitems.Layout(gtx, s.theme)
+				}),
+				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+					if s.tabitems.CurrentView() < 0 || s.tabitems.CurrentView() >= len(s.openPaths) {
+						return layout.Dimensions{}
+					}
+					path := s.openPaths[s.tabitems.CurrentView()]
+					fv, ok := s.openFiles[path]
+					if !ok {
+						return layout.Dimensions{}
+					}
+					if s.focusEditor {
+						s.focusEditor = false
+						gtx.Execute(key.FocusCmd{Tag: fv.Editor})
+					}
+					return fv.Layout(gtx, s.theme)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					if !s.references.visible {
+						return layout.Dimensions{}
+					}
+					return divider.NewDivider(layout.Horizontal, unit.Dp(1), s.theme.Base.SurfaceHighlight).Layout(gtx, s.theme)
+				}),
+				layout.Rigid(s.layoutReferences),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					if !s.hierarchy.visible {
+						return layout.Dimensions{}
+					}
+					return divider.NewDivider(layout.Horizontal, unit.Dp(1), s.theme.Base.SurfaceHighlight).Layout(gtx, s.theme)
+				}),
+				layout.Rigid(s.layoutHierarchy),
+			)
 		}),
-		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
-			if s.tabitems.CurrentView() < 0 || s.tabitems.CurrentView() >= len(s.openPaths) {
-				return layout.Dimensions{}
-			}
-			path := s.openPaths[s.tabitems.CurrentView()]
-			fv, ok := s.openFiles[path]
-			if !ok {
-				return layout.Dimensions{}
-			}
-			return fv.Layout(gtx, s.theme)
+		layout.Expanded(func(gtx layout.Context) layout.Dimensions {
+			return s.picker.Layout(gtx, s.theme)
+		}),
+		layout.Expanded(s.layoutRename),
+		layout.Expanded(s.layoutSymbolSearch),
+		layout.Expanded(func(gtx layout.Context) layout.Dimensions {
+			return s.notifications.Layout(gtx, s.theme)
 		}),
 	)
 }
@@ -204,13 +270,24 @@ func (s *appState) saveCurrentFile() {
 	if !ok {
 		return
 	}
+	if entry := s.lspManager.ServerForFile(path); entry != nil {
+		if entry.OrganizeImportsOnSave {
+			s.organizeImportsBeforeSave(fv)
+		}
+		if entry.FormatOnSave {
+			s.formatBeforeSave(fv)
+		}
+	}
 	content := fv.Editor.Text()
 	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
 		log.Printf("save %q: %v", path, err)
 		return
 	}
 	fv.OriginalContent = content
-	s.openFiles[path] = fv
+	go s.workspaceIndex.refresh(path)
+	if isSnippetFile(".", path) {
+		s.userSnippets.check(s)
+	}
 	if tab := s.openTabs[path]; tab != nil {
 		tab.State = tabs.TabStateClean
 	}
@@ -219,9 +296,35 @@ func (s *appState) saveCurrentFile() {
 	}
 }
 
+// runOnUI queues fn to run on the UI goroutine before the next frame and wakes up the window.
+// LSP responses arrive on background goroutines; use this to hand results to the editor state.
+func (s *appState) runOnUI(fn func()) {
+	s.uiQueueMu.Lock()
+	s.uiQueue = append(s.uiQueue, fn)
+	s.uiQueueMu.Unlock()
+	if s.window != nil {
+		s.window.Invalidate()
+	}
+}
+
+// drainUIQueue runs the work queued by runOnUI.
+func (s *appState) drainUIQueue() {
+	s.uiQueueMu.Lock()
+	queue := s.uiQueue
+	s.uiQueue = nil
+	s.uiQueueMu.Unlock()
+	for _, fn := range queue {
+		fn()
+	}
+}
+
+// lspShutdownTimeout bounds how long closing the window waits for language servers to exit.
+const lspShutdownTimeout = 3 * time.Second
+
 // runApp starts the main application loop.
 func runApp(w *app.Window) error {
 	state := newAppState()
+	state.window = w
 
 	var ops op.Ops
 	for {
@@ -231,7 +334,12 @@ func runApp(w *app.Window) error {
 			state.appLayout(gtx)
 			e.Frame(gtx.Ops)
 		case app.DestroyEvent:
-			os.Exit(0)
+			ctx, cancel := context.WithTimeout(context.Background(), lspShutdownTimeout)
+			if err := state.lspManager.CloseAll(ctx); err != nil {
+				log.Printf("[LSP] shutdown: %v", err)
+			}
+			cancel()
+			return e.Err
 		}
 	}
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"image"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/widget"
+	"github.com/mirzakhany/void/lsp"
+	"github.com/oligo/gvcode"
+	"go.lsp.dev/protocol"
+	mdicons "golang.org/x/exp/shiny/materialdesign/icons"
+)
+
+// codeActionCmdTag is the tag for the Ctrl+. / Cmd+. (show code actions) command registered with the editor.
+var codeActionCmdTag struct{}
+
+var lightbulbIcon = func() *widget.Icon { icon, _ := widget.NewIcon(mdicons.ActionLightbulbOutline); return icon }()
+
+// lightbulb is the gutter button shown on the caret line when the caret is inside a diagnostic.
+// Clicking it lists the code actions for the caret.
+type lightbulb struct {
+	click widget.Clickable
+}
+
+// Layout draws the lightbulb in the gap between the line numbers and the text of the caret line
+// and reports whether it was clicked.
+func (b *lightbulb) Layout(gtx layout.Context, ed *gvcode.Editor) bool {
+	clicked := b.click.Clicked(gtx)
+	size := gtx.Dp(editorGutterGap)
+	caret := ed.CaretCoords()
+	pos := image.Pt(ed.GutterWidth()-size, int(caret.Y)-size+gtx.Dp(2))
+	if pos.X < 0 || pos.Y < 0 || pos.Y+size > gtx.Constraints.Max.Y {
+		return clicked
+	}
+	defer op.Offset(pos).Push(gtx.Ops).Pop()
+	gtx.Constraints = layout.Exact(image.Pt(size, size))
+	b.click.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return lightbulbIcon.Layout(gtx, warningColor)
+	})
+	return clicked
+}
+
+// showCodeActions requests the code actions for the selection (or the caret) and lists them in
+// the picker; picking one runs it. diagnostics are the document's current diagnostics, the ones
+// overlapping the selection are sent along.
+func (s *appState) showCodeActions(c *lsp.Client, docURI protocol.DocumentURI, ed *gvcode.Editor, diagnostics []protocol.Diagnostic) {
+	if !c.Supports(protocol.MethodTextDocumentCodeAction) {
+		return
+	}
+	text := ed.Text()
+	start, end := ed.Selection()
+	start, end = min(start, end), max(start, end)
+	rng := protocol.Range{
+		Start: lsp.RuneOffsetToPosition(text, start),
+		End:   lsp.RuneOffsetToPosition(text, end),
+	}
+	var overlapping []protocol.Diagnostic
+	for _, d := range diagnostics {
+		dStart, dEnd := lsp.RangeToRuneOffsets(text, d.Range)
+		if dStart <= end && start <= max(dEnd, dStart+1) {
+			overlapping = append(overlapping, d)
+		}
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		actions, err := c.CodeActions(ctx, docURI, rng, overlapping, nil)
+		if err != nil {
+			log.Printf("[LSP] codeAction failed for %q: %v", docURI, err)
+			return
+		}
+		s.runOnUI(func() {
+			if len(actions) == 0 {
+				s.notifications.add("No code actions available")
+				return
+			}
+			items := make([]pickerItem, len(actions))
+			for i, a := range actions {
+				items[i] = pickerItem{Label: a.Title, Detail: string(a.Kind)}
+				if a.IsPreferred {
+					items[i].Label = "★ " + a.Title
+				}
+				if a.Disabled != nil {
+					items[i].Detail = a.Disabled.Reason
+				}
+			}
+			s.picker.show("Code actions", items, func(i int) {
+				s.runCodeAction(c, actions[i])
+			})
+		})
+	}()
+}
+
+// runCodeAction applies a code action: it resolves the edit if the server left it out, applies
+// it to the workspace and then executes the action's command, if any.
+func (s *appState) runCodeAction(c *lsp.Client, action protocol.CodeAction) {
+	if action.Disabled != nil {
+		s.notifications.add(action.Title + ": " + action.Disabled.Reason)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		if action.Edit == nil && action.Data != nil && c.Supports(lsp.MethodCodeActionResolve) {
+			resolved, err := c.ResolveCodeAction(ctx, action)
+			if err != nil {
+				log.Printf("[LSP] codeAction/resolve %q: %v", action.Title, err)
+				return
+			}
+			action = resolved
+		}
+		if action.Edit != nil && !s.applyServerEdit(*action.Edit) {
+			s.notify(action.Title + ": the edit could not be applied")
+			return
+		}
+		if action.Command != nil {
+			if err := c.ExecuteCommand(ctx, *action.Command); err != nil {
+				log.Printf("[LSP] executeCommand %q: %v", action.Command.Command, err)
+				s.notify(action.Title + ": " + err.Error())
+			}
+		}
+	}()
+}
+
+// organizeImportsBeforeSave runs the server's source.organizeImports code action on fv's document
+// synchronously; it is called by saveCurrentFile before the text is written. Actions that only
+// carry a command are skipped: the server would apply their edit through the UI goroutine, which
+// is busy saving.
+func (s *appState) organizeImportsBeforeSave(fv *fileView) {
+	c := fv.LSPClient
+	if c == nil || !c.Supports(protocol.MethodTextDocumentCodeAction) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), onSaveTimeout)
+	defer cancel()
+	text := fv.Editor.Text()
+	docURI := protocol.DocumentURI(fv.LSPDocURI)
+	rng := protocol.Range{End: lsp.RuneOffsetToPosition(text, utf8.RuneCountInString(text))}
+	actions, err := c.CodeActions(ctx, docURI, rng, nil, []protocol.CodeActionKind{protocol.SourceOrganizeImports})
+	if err != nil {
+		log.Printf("[LSP] organize imports on save %q: %v", fv.Path, err)
+		return
+	}
+	for _, action := range actions {
+		// Servers may ignore the kinds we asked for.
+		if action.Kind != protocol.SourceOrganizeImports && !strings.HasPrefix(string(action.Kind), string(protocol.SourceOrganizeImports)+".") {
+			continue
+		}
+		if action.Edit == nil && action.Data != nil && c.Supports(lsp.MethodCodeActionResolve) {
+			resolved, err := c.ResolveCodeAction(ctx, action)
+			if err != nil {
+				log.Printf("[LSP] codeAction/resolve %q: %v", action.Title, err)
+				return
+			}
+			action = resolved
+		}
+		if action.Edit == nil {
+			log.Printf("[LSP] organize imports on save %q: %q has no edit, skipped", fv.Path, action.Title)
+			continue
+		}
+		if err := s.applyWorkspaceEdit(*action.Edit); err != nil {
+			log.Printf("[LSP] organize imports on save %q: %v", fv.Path, err)
+		}
+		return
+	}
+}
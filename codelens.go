@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"image"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/mirzakhany/void/lsp"
+	"github.com/oligo/gvcode"
+	"go.lsp.dev/protocol"
+)
+
+// codeLensDelay is how long code lenses wait after an edit before they are requested again.
+const codeLensDelay = 500 * time.Millisecond
+
+// codeLensCommandTimeout bounds a lens command. It is longer than lspRequestTimeout because
+// commands like running a test or go mod tidy take a while.
+const codeLensCommandTimeout = 2 * time.Minute
+
+// codeLens is a lens at a rune offset of the document.
+type codeLens struct {
+	lens   protocol.CodeLens
+	offset int
+	// resolved is set once the lens has a command or codeLens/resolve has answered for it, even
+	// without one or with an error; such a lens is not resolved again.
+	resolved  bool
+	resolving bool
+	click     widget.Clickable
+}
+
+// codeLensLine is the lenses of one line, in order, and the line's indentation in runes.
+type codeLensLine struct {
+	line, indent int
+	lenses       []*codeLens
+}
+
+// codeLenses shows the server's textDocument/codeLens results. The editor cannot insert a line,
+// so a line's lenses are drawn in the line above it: after its end, but not left of the lensed
+// line's indentation. Clicking a lens runs its command with workspace/executeCommand.
+type codeLenses struct {
+	lenses []*codeLens // sorted by offset into text
+	text   string
+	lines  []codeLensLine // lenses grouped by line, see set
+	loaded bool
+	timer  *time.Timer
+	// seq is bumped on every request so late responses are dropped.
+	seq int
+}
+
+// update keeps the lenses in step with the editor: after an edit they move with the text and are
+// requested again once typing pauses. Lenses of the visible lines that came without a command
+// are resolved. changed reports whether the text was edited this frame.
+func (l *codeLenses) update(s *appState, c *lsp.Client, docURI protocol.DocumentURI, ed *gvcode.Editor, changed bool) {
+	if !c.Supports(protocol.MethodTextDocumentCodeLens) {
+		return
+	}
+	if !l.loaded {
+		l.loaded = true
+		l.request(s, c, docURI, ed)
+	}
+	if changed {
+		text := ed.Text()
+		l.set(shiftCodeLenses(l.lenses, l.text, text), text)
+		l.seq++
+		seq := l.seq
+		if l.timer != nil {
+			l.timer.Stop()
+		}
+		l.timer = time.AfterFunc(codeLensDelay, func() {
+			s.runOnUI(func() {
+				if seq == l.seq {
+					l.request(s, c, docURI, ed)
+				}
+			})
+		})
+	}
+	l.resolveVisible(s, c, ed)
+}
+
+// request asks the server for the document's lenses in the background.
+func (l *codeLenses) request(s *appState, c *lsp.Client, docURI protocol.DocumentURI, ed *gvcode.Editor) {
+	l.seq++
+	seq := l.seq
+	text := ed.Text()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		result, err := c.CodeLenses(ctx, docURI)
+		if err != nil {
+			log.Printf("[LSP] codeLens failed for %q: %v", docURI, err)
+			return
+		}
+		positions := make([]protocol.Position, len(result))
+		for i, r := range result {
+			positions[i] = r.Range.Start
+		}
+		offsets := lsp.RuneOffsets(text, positions)
+		lenses := make([]*codeLens, len(result))
+		for i, r := range result {
+			lenses[i] = &codeLens{lens: r, offset: offsets[i], resolved: r.Command != nil}
+		}
+		s.runOnUI(func() {
+			if seq != l.seq {
+				return
+			}
+			l.set(lenses, text)
+		})
+	}()
+}
+
+// resolveVisible sends codeLens/resolve for the lenses of the visible lines that have not been
+// resolved yet.
+func (l *codeLenses) resolveVisible(s *appState, c *lsp.Client, ed *gvcode.Editor) {
+	if !c.Supports(protocol.MethodCodeLensResolve) {
+		return
+	}
+	first, last := visibleLines(ed)
+	for _, ll := range l.lines {
+		if ll.line < first || ll.line >= last {
+			continue
+		}
+		for _, lens := range ll.lenses {
+			if lens.resolved || lens.resolving {
+				continue
+			}
+			lens.resolving = true
+			unresolved := lens.lens
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+				defer cancel()
+				resolved, err := c.ResolveCodeLens(ctx, unresolved)
+				if err != nil {
+					log.Printf("[LSP] codeLens/resolve failed: %v", err)
+				}
+				s.runOnUI(func() {
+					lens.resolving, lens.resolved = false, true
+					if err == nil {
+						lens.lens.Command = resolved.Command
+					}
+				})
+			}()
+		}
+	}
+}
+
+// set replaces the lenses with lenses for text and groups them by line. Lenses past the end of
+// text are dropped.
+func (l *codeLenses) set(lenses []*codeLens, text string) {
+	slices.SortStableFunc(lenses, func(a, b *codeLens) int { return a.offset - b.offset })
+	l.lenses, l.text = lenses, text
+	l.lines = nil
+	i, off := 0, 0
+	for line, lineText := range strings.Split(text, "\n") {
+		if i == len(lenses) {
+			break
+		}
+		end := off + utf8.RuneCountInString(lineText)
+		if lenses[i].offset <= end {
+			indent := utf8.RuneCountInString(lineText) - utf8.RuneCountInString(strings.TrimLeftFunc(lineText, unicode.IsSpace))
+			for i < len(lenses) && lenses[i].offset <= end {
+				l.addLens(line, indent, lenses[i])
+				i++
+			}
+		}
+		off = end + 1
+	}
+}
+
+func (l *codeLenses) addLens(line, indent int, lens *codeLens) {
+	if n := len(l.lines); n > 0 && l.lines[n-1].line == line {
+		l.lines[n-1].lenses = append(l.lines[n-1].lenses, lens)
+		return
+	}
+	l.lines = append(l.lines, codeLensLine{line: line, indent: indent, lenses: []*codeLens{lens}})
+}
+
+// shiftCodeLenses moves lenses computed for oldText to where their text is in newText. Lenses
+// inside the changed text are dropped.
+func shiftCodeLenses(lenses []*codeLens, oldText, newText string) []*codeLens {
+	if len(lenses) == 0 {
+		return nil
+	}
+	start, oldEnd, delta := changedSpan(oldText, newText)
+	shifted := make([]*codeLens, 0, len(lenses))
+	for _, lens := range lenses {
+		switch {
+		case lens.offset <= start:
+			shifted = append(shifted, lens)
+		case lens.offset >= oldEnd:
+			lens.offset += delta
+			shifted = append(shifted, lens)
+		}
+	}
+	return shifted
+}
+
+// Layout draws the lenses of the visible lines and returns the one that was clicked, if any.
+// Lenses without a command are not drawn.
+func (l *codeLenses) Layout(gtx layout.Context, th *theme.Theme, ed *gvcode.Editor, size image.Point) *codeLens {
+	var clicked *codeLens
+	for _, lens := range l.lenses {
+		if lens.click.Clicked(gtx) {
+			clicked = lens
+		}
+	}
+	if len(l.lines) == 0 {
+		return clicked
+	}
+	gutter := ed.GutterWidth()
+	defer clip.Rect{Min: image.Pt(gutter, 0), Max: size}.Push(gtx.Ops).Pop()
+	first, last := visibleLines(ed)
+	gap := gtx.Dp(unit.Dp(12))
+	for _, ll := range l.lines {
+		if ll.line < first || ll.line >= last {
+			continue
+		}
+		_, start := ed.ConvertPos(ll.line, ll.indent)
+		var pos image.Point
+		if ll.line == 0 {
+			// No line above: draw after the end of the line itself.
+			_, end := ed.ConvertPos(0, math.MaxInt32)
+			pos = image.Pt(int(end.X)+gap, int(end.Y))
+		} else {
+			_, end := ed.ConvertPos(ll.line-1, math.MaxInt32)
+			x := int(start.X)
+			if end.X > 0 {
+				x = max(x, int(end.X)+gap)
+			}
+			pos = image.Pt(x, int(end.Y))
+		}
+		pos = image.Pt(gutter+pos.X, pos.Y-gtx.Sp(editorTextSize))
+		if pos.Y > size.Y {
+			continue
+		}
+		offset := op.Offset(pos).Push(gtx.Ops)
+		l.layoutLine(gtx, th, ll.lenses)
+		offset.Pop()
+	}
+	return clicked
+}
+
+// layoutLine draws the titles of a line's lenses separated by bars.
+func (l *codeLenses) layoutLine(gtx layout.Context, th *theme.Theme, lenses []*codeLens) layout.Dimensions {
+	gtx.Constraints.Min = image.Point{}
+	children := make([]layout.FlexChild, 0, 2*len(lenses))
+	label := func(gtx layout.Context, text string, hovered bool) layout.Dimensions {
+		lb := material.Label(th.Material(), unit.Sp(11), text)
+		lb.Color = th.Base.TextSubtle
+		if hovered {
+			lb.Color = th.Base.Text
+		}
+		lb.MaxLines = 1
+		return lb.Layout(gtx)
+	}
+	for _, lens := range lenses {
+		if lens.lens.Command == nil || lens.lens.Command.Title == "" {
+			continue
+		}
+		if len(children) > 0 {
+			children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Inset{Left: unit.Dp(6), Right: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return label(gtx, "|", false)
+				})
+			}))
+		}
+		children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return lens.click.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				defer pointer.CursorPointer.Add(gtx.Ops)
+				return label(gtx, lens.lens.Command.Title, lens.click.Hovered())
+			})
+		}))
+	}
+	return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx, children...)
+}
+
+// runCodeLens executes the command of a clicked lens in the background.
+func (s *appState) runCodeLens(c *lsp.Client, lens *codeLens) {
+	cmd := lens.lens.Command
+	if cmd == nil || cmd.Command == "" {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), codeLensCommandTimeout)
+		defer cancel()
+		if err := c.ExecuteCommand(ctx, *cmd); err != nil {
+			log.Printf("[LSP] executeCommand %q: %v", cmd.Command, err)
+			s.notify(cmd.Title + ": " + err.Error())
+		}
+	}()
+}
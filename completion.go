@@ -1,18 +1,21 @@
 package main
 
 import (
-	"strings"
 	"unicode"
 
 	"gioui.org/io/key"
+	"github.com/mirzakhany/void/lsp"
 	"github.com/oligo/gvcode"
 )
 
-// projectCompletor suggests completions from the project index and member index.
+// projectCompletor suggests completions from the project index and member index. With a
+// workspace they are taken from its latest snapshot on every request.
 type projectCompletor struct {
 	editor      *gvcode.Editor
+	workspace   *workspaceIndex // may be nil
 	index       []string
 	memberIndex map[string][]string
+	ranker      *lsp.CompletionRanker // made if nil
 }
 
 func isSymbolSeparator(ch rune) bool {
@@ -43,7 +46,14 @@ func (c *projectCompletor) textBeforeCaret(runePos int) []rune {
 	return runes[:runePos]
 }
 
+// Suggest returns the members of the receiver before a ".", or else the indexed identifiers, that
+// fuzzy-match the word before the caret. The word is matched here because a session started with
+// Ctrl+Space in the middle of a word does not pass it to FilterAndRank; a session started by
+// typing does, and Rank narrows the candidates further as the user types.
 func (c *projectCompletor) Suggest(ctx gvcode.CompletionContext) []gvcode.CompletionCandidate {
+	if c.workspace != nil {
+		c.index, c.memberIndex = c.workspace.snapshot()
+	}
 	before := c.textBeforeCaret(ctx.Position.Runes)
 	if len(before) == 0 {
 		return nil
@@ -61,7 +71,7 @@ func (c *projectCompletor) Suggest(ctx gvcode.CompletionContext) []gvcode.Comple
 		if list, ok := c.memberIndex[receiver]; ok {
 			candidates := make([]gvcode.CompletionCandidate, 0)
 			for _, m := range list {
-				if strings.HasPrefix(m, memberPrefix) {
+				if score, _ := lsp.FuzzyMatch(memberPrefix, m); score >= 0 {
 					candidates = append(candidates, gvcode.CompletionCandidate{
 						Label: m,
 						TextEdit: gvcode.TextEdit{
@@ -81,7 +91,7 @@ func (c *projectCompletor) Suggest(ctx gvcode.CompletionContext) []gvcode.Comple
 	prefix := c.editor.ReadUntil(-1, isSymbolSeparator)
 	candidates := make([]gvcode.CompletionCandidate, 0)
 	for _, w := range c.index {
-		if strings.HasPrefix(w, prefix) {
+		if score, _ := lsp.FuzzyMatch(prefix, w); score >= 0 {
 			candidates = append(candidates, gvcode.CompletionCandidate{
 				Label: w,
 				TextEdit: gvcode.TextEdit{
@@ -114,15 +124,19 @@ func trimIdentifierLeft(r []rune) []rune {
 	return nil
 }
 
+// FilterAndRank fuzzy-matches the candidates' labels, see lsp.CompletionRanker.
 func (c *projectCompletor) FilterAndRank(pattern string, candidates []gvcode.CompletionCandidate) []gvcode.CompletionCandidate {
-	if pattern == "" {
-		return candidates
+	if c.ranker == nil {
+		c.ranker = &lsp.CompletionRanker{}
 	}
-	filtered := make([]gvcode.CompletionCandidate, 0)
-	for _, cand := range candidates {
-		if strings.HasPrefix(strings.ToLower(cand.Label), strings.ToLower(pattern)) {
-			filtered = append(filtered, cand)
-		}
+	keys := make([]lsp.RankKey, len(candidates))
+	for i, cand := range candidates {
+		keys[i] = lsp.RankKey{Label: cand.Label}
+	}
+	order := c.ranker.Rank(pattern, keys)
+	filtered := make([]gvcode.CompletionCandidate, len(order))
+	for i, idx := range order {
+		filtered[i] = candidates[idx]
 	}
 	return filtered
 }
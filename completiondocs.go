@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"image"
+	"log"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/x/richtext"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/mirzakhany/void/lsp"
+	"go.lsp.dev/protocol"
+)
+
+// completionDocs is the panel next to the completion popup that documents the selected candidate:
+// its full signature (the item's detail) above its rendered documentation. Servers may leave both
+// out of the completion results, so the selected item is resolved with completionItem/resolve
+// first.
+type completionDocs struct {
+	item      *lsp.CompletionItem // the item shown, nil when there is none
+	resolving *lsp.CompletionItem
+	detail    string
+	empty     bool // the item has neither detail nor documentation
+	signature richtext.InteractiveText
+	sigSpans  codeHighlight // detail, highlighted
+	content   markdownView
+}
+
+// update shows the item of the idx-th candidate of completor and resolves it in the background
+// if that has not been done yet.
+func (d *completionDocs) update(s *appState, completor *lsp.Completor, idx int) {
+	item := completor.Item(idx)
+	if item != d.item {
+		d.show(item)
+	}
+	c := completor.Client
+	if item == nil || item.Resolved || item.ResolveFailed || item == d.resolving || !c.Supports(protocol.MethodCompletionItemResolve) {
+		return
+	}
+	d.resolving = item
+	unresolved := *item
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		resolved, err := c.ResolveCompletionItem(ctx, unresolved)
+		if err != nil {
+			log.Printf("[LSP] completionItem/resolve failed for %q: %v", unresolved.Label, err)
+		}
+		s.runOnUI(func() {
+			if d.resolving == item {
+				d.resolving = nil
+			}
+			if err != nil {
+				item.ResolveFailed = true
+				return
+			}
+			*item = resolved
+			if d.item == item {
+				d.show(item)
+			}
+		})
+	}()
+}
+
+// show replaces the panel's contents with item's, or empties it if item is nil.
+func (d *completionDocs) show(item *lsp.CompletionItem) {
+	d.item = item
+	if item == nil {
+		d.detail, d.empty = "", true
+		return
+	}
+	d.detail = item.Detail
+	doc := item.Docs()
+	if doc.Kind == protocol.Markdown {
+		d.content.SetText(doc.Value)
+	} else {
+		d.content.SetPlainText(doc.Value)
+	}
+	d.empty = d.detail == "" && doc.Value == ""
+}
+
+// Layout draws the panel: the signature highlighted as code in lang, then the documentation.
+func (d *completionDocs) Layout(gtx layout.Context, th *theme.Theme, lang string) layout.Dimensions {
+	if d.empty {
+		return layout.Dimensions{}
+	}
+	textSize := unit.Sp(12)
+	gtx.Constraints.Min = image.Point{}
+	macro := op.Record(gtx.Ops)
+	dims := layout.UniformInset(unit.Dp(8)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				if d.detail == "" {
+					return layout.Dimensions{}
+				}
+				return layout.Inset{Bottom: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					spans := d.sigSpans.get(d.detail, lang, th.Material().Fg, textSize)
+					return richtext.Text(&d.signature, th.Material().Shaper, spans...).Layout(gtx)
+				})
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				if d.content.src == "" {
+					return layout.Dimensions{}
+				}
+				return d.content.Layout(gtx, th, textSize)
+			}),
+		)
+	})
+	call := macro.Stop()
+
+	defer clip.UniformRRect(image.Rectangle{Max: dims.Size}, gtx.Dp(unit.Dp(4))).Push(gtx.Ops).Pop()
+	paint.Fill(gtx.Ops, th.Base.SurfaceHighlight)
+	call.Add(gtx.Ops)
+	return dims
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"image"
+	"image/color"
+
+	"gioui.org/font"
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"gioui.org/x/styledtext"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/mirzakhany/void/lsp"
+	"github.com/oligo/gvcode"
+)
+
+// completionPopup lists the completion candidates under the caret. It takes the place of
+// gvcode's default popup so that the selected candidate is known outside of it, e.g. to accept
+// it when one of its commit characters is typed. Up/Down move the selection; Enter, Tab or a
+// click accept it; Escape closes the popup. With a language server, the selected candidate is
+// documented in a panel beside the list and deprecated candidates are struck through. The runes
+// of the labels that matched what was typed are highlighted.
+type completionPopup struct {
+	state  *appState
+	editor *gvcode.Editor
+	cmp    gvcode.Completion
+	theme  *theme.Theme
+	list   widget.List
+	clicks []widget.Clickable
+	// count is the number of candidates listed; selected indexes them.
+	count    int
+	selected int
+	// lsp is the language server's completor, if any; lang is the document's language, used
+	// to highlight signatures in docs.
+	lsp  *lsp.Completor
+	lang string
+	docs completionDocs
+	// ranker knows which runes of the listed labels matched what was typed.
+	ranker *lsp.CompletionRanker
+}
+
+func newCompletionPopup(s *appState, ed *gvcode.Editor, cmp gvcode.Completion, th *theme.Theme) *completionPopup {
+	return &completionPopup{state: s, editor: ed, cmp: cmp, theme: th}
+}
+
+// Layout implements gvcode.CompletionPopup.
+func (p *completionPopup) Layout(gtx layout.Context, items []gvcode.CompletionCandidate) layout.Dimensions {
+	p.count = len(items)
+	if !p.cmp.IsActive() || len(items) == 0 {
+		p.reset()
+		return layout.Dimensions{}
+	}
+	p.registerCommands()
+	for len(p.clicks) < len(items) {
+		p.clicks = append(p.clicks, widget.Clickable{})
+	}
+	p.selected = min(p.selected, len(items)-1)
+	for i := range items {
+		if p.clicks[i].Clicked(gtx) {
+			p.cmp.OnConfirm(i)
+			gtx.Execute(key.FocusCmd{Tag: p.editor})
+			gtx.Execute(op.InvalidateCmd{})
+			return layout.Dimensions{}
+		}
+	}
+
+	th := p.theme
+	gtx.Constraints.Max.Y = min(gtx.Constraints.Max.Y, gtx.Dp(unit.Dp(200)))
+	gtx.Constraints.Min = image.Point{}
+	if p.lsp == nil {
+		return p.layoutList(gtx, th, items)
+	}
+	p.docs.update(p.state, p.lsp, p.selected)
+	return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return p.layoutList(gtx, th, items)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Left: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				gtx.Constraints.Max.X = min(gtx.Constraints.Max.X, gtx.Dp(unit.Dp(320)))
+				return p.docs.Layout(gtx, th, p.lang)
+			})
+		}),
+	)
+}
+
+// layoutList draws the candidates in a rounded, scrollable box.
+func (p *completionPopup) layoutList(gtx layout.Context, th *theme.Theme, items []gvcode.CompletionCandidate) layout.Dimensions {
+	gtx.Constraints.Max.X = min(gtx.Constraints.Max.X, gtx.Dp(unit.Dp(400)))
+	gtx.Constraints.Min = image.Pt(gtx.Constraints.Max.X, 0)
+	macro := op.Record(gtx.Ops)
+	dims := layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		p.list.Axis = layout.Vertical
+		li := material.List(th.Material(), &p.list)
+		li.AnchorStrategy = material.Overlay
+		return li.Layout(gtx, len(items), func(gtx layout.Context, i int) layout.Dimensions {
+			return p.layoutItem(gtx, th, items[i], i)
+		})
+	})
+	call := macro.Stop()
+
+	defer clip.UniformRRect(image.Rectangle{Max: dims.Size}, gtx.Dp(unit.Dp(4))).Push(gtx.Ops).Pop()
+	paint.Fill(gtx.Ops, th.Base.SurfaceHighlight)
+	call.Add(gtx.Ops)
+	return dims
+}
+
+// layoutItem draws a candidate row: its kind, label and description.
+func (p *completionPopup) layoutItem(gtx layout.Context, th *theme.Theme, item gvcode.CompletionCandidate, i int) layout.Dimensions {
+	textSize := unit.Sp(12)
+	deprecated := false
+	if p.lsp != nil {
+		if it := p.lsp.Item(i); it != nil {
+			deprecated = it.IsDeprecated()
+		}
+	}
+	return p.clicks[i].Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Background{}.Layout(gtx,
+			func(gtx layout.Context) layout.Dimensions {
+				if i == p.selected || p.clicks[i].Hovered() {
+					fill := th.Material().ContrastBg
+					fill.A = 0x60
+					if i != p.selected {
+						fill.A = 0x20
+					}
+					paint.FillShape(gtx.Ops, fill, clip.Rect{Max: gtx.Constraints.Min}.Op())
+				}
+				return layout.Dimensions{Size: gtx.Constraints.Min}
+			},
+			func(gtx layout.Context) layout.Dimensions {
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return layout.Inset{Top: unit.Dp(2), Bottom: unit.Dp(2), Left: unit.Dp(6), Right: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							lb := material.Label(th.Material(), textSize-1, item.Kind)
+							lb.Color = th.Base.TextSubtle
+							return lb.Layout(gtx)
+						}),
+						layout.Rigid(layout.Spacer{Width: unit.Dp(4)}.Layout),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							fg := th.Base.Text
+							if deprecated {
+								fg = th.Base.TextSubtle
+							}
+							var matches []int
+							if p.ranker != nil {
+								matches = p.ranker.Matches(i)
+							}
+							spans := matchSpans(item.Label, matches, font.Font{Weight: font.SemiBold}, textSize, fg, th.Base.Info)
+							dims := styledtext.Text(th.Material().Shaper, spans...).Layout(gtx, nil)
+							if deprecated {
+								strikeThrough(gtx, dims, fg, textSize)
+							}
+							return dims
+						}),
+						layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+							return layout.Inset{Left: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+								lb := material.Label(th.Material(), textSize-1, item.Description)
+								lb.Color = th.Base.TextSubtle
+								lb.Alignment = text.End
+								lb.MaxLines = 1
+								return lb.Layout(gtx)
+							})
+						}),
+					)
+				})
+			},
+		)
+	})
+}
+
+// matchSpans splits label into spans, coloring the runes at the indices in matches with hl and
+// the others with fg.
+func matchSpans(label string, matches []int, f font.Font, size unit.Sp, fg, hl color.NRGBA) []styledtext.SpanStyle {
+	runes := []rune(label)
+	matched := make([]bool, len(runes))
+	for _, m := range matches {
+		if m < len(runes) {
+			matched[m] = true
+		}
+	}
+	var spans []styledtext.SpanStyle
+	for start := 0; start < len(runes); {
+		end := start + 1
+		for end < len(runes) && matched[end] == matched[start] {
+			end++
+		}
+		span := styledtext.SpanStyle{Font: f, Size: size, Color: fg, Content: string(runes[start:end])}
+		if matched[start] {
+			span.Color = hl
+		}
+		spans = append(spans, span)
+		start = end
+	}
+	return spans
+}
+
+// strikeThrough draws a line of color c through the text of size size laid out with dims.
+func strikeThrough(gtx layout.Context, dims layout.Dimensions, c color.NRGBA, size unit.Sp) {
+	y := dims.Size.Y - dims.Baseline - gtx.Sp(size)*3/10
+	rect := image.Rect(0, y, dims.Size.X, y+max(gtx.Dp(unit.Dp(1)), 1))
+	paint.FillShape(gtx.Ops, c, clip.Rect(rect).Op())
+}
+
+// registerCommands binds the popup's keys in the editor while it is shown.
+func (p *completionPopup) registerCommands() {
+	move := func(delta int) gvcode.CommandHandler {
+		return func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			p.selected = max(min(p.selected+delta, p.count-1), 0)
+			if pos := p.list.Position; p.selected < pos.First {
+				p.list.ScrollTo(p.selected)
+			} else if pos.Count > 1 && p.selected >= pos.First+pos.Count-1 {
+				p.list.ScrollTo(p.selected - pos.Count + 2)
+			}
+			return nil
+		}
+	}
+	accept := func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+		if p.selected < p.count {
+			p.cmp.OnConfirm(p.selected)
+		}
+		return nil
+	}
+	p.editor.RegisterCommand(p, key.Filter{Name: key.NameUpArrow, Optional: key.ModShift}, move(-1))
+	p.editor.RegisterCommand(p, key.Filter{Name: key.NameDownArrow, Optional: key.ModShift}, move(1))
+	p.editor.RegisterCommand(p, key.Filter{Name: key.NameEnter, Optional: key.ModShift}, accept)
+	p.editor.RegisterCommand(p, key.Filter{Name: key.NameReturn, Optional: key.ModShift}, accept)
+	p.editor.RegisterCommand(p, key.Filter{Name: key.NameTab, Optional: key.ModShift}, accept)
+	p.editor.RegisterCommand(p, key.Filter{Name: key.NameEscape},
+		func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			p.cmp.Cancel()
+			return nil
+		})
+}
+
+// reset clears the selection and unbinds the popup's keys once it is hidden.
+func (p *completionPopup) reset() {
+	p.selected = 0
+	p.list.Position = layout.Position{}
+	p.docs.show(nil)
+	p.editor.RemoveCommands(p)
+}
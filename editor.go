@@ -8,7 +8,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"gioui.org/io/key"
@@ -36,24 +38,117 @@ import (
 // saveCmdTag is the tag for the Cmd+S save command registered with the editor.
 var saveCmdTag struct{}
 
+// Editor text metrics, shared with overlays that are positioned relative to editor lines.
+const (
+	editorTextSize   = unit.Sp(14)
+	editorLineHeight = 1.35 // multiple of the text size
+	editorTabWidth   = 4
+	editorGutterGap  = unit.Dp(12) // between the line numbers and the text
+)
+
+// lspRequestTimeout bounds interactive LSP requests (hover, navigation, ...) made from the UI.
+const lspRequestTimeout = 5 * time.Second
+
 // completionWrapper wraps DefaultCompletion so that typing a trigger character (e.g. ".")
 // cancels the current session first. That forces a new session and a fresh LSP Suggest()
 // call, so we get member completions (e.g. fmt.Println after "fmt.").
+// With a language server it also makes the additional edits of the accepted item (e.g. an
+// import) and accepts the selected item when one of its commit characters is typed. Accepted
+// candidates are recorded so that they rank higher next time. Snippet candidates, from the
+// server or the user's snippet files, are expanded by the editor's snippetSession.
 type completionWrapper struct {
 	*completion.DefaultCompletion
-	triggerChars map[string]bool
+	triggerChars []string // the language server's completion trigger characters
+	lsp          *lsp.Completor
+	snippets     *snippetCompletor
+	snippet      *snippetSession
+	popup        *completionPopup
+	ranker       *lsp.CompletionRanker
+	path         string
+	theme        *theme.Theme
 }
 
 func (w *completionWrapper) OnText(ctx gvcode.CompletionContext) {
-	if w.triggerChars[ctx.Input] {
+	if w.commit(ctx) {
+		return
+	}
+	if slices.Contains(w.triggerChars, ctx.Input) {
 		w.Cancel()
 	}
 	w.DefaultCompletion.OnText(ctx)
 }
 
+// OnConfirm inserts the idx-th candidate, then makes the server item's additional edits.
+func (w *completionWrapper) OnConfirm(idx int) {
+	w.ranker.Accept(idx)
+	if cand, ok := w.snippets.candidate(idx); ok && strings.EqualFold(cand.TextFormat, "snippet") {
+		w.insertSnippet(cand)
+	} else {
+		w.DefaultCompletion.OnConfirm(idx)
+	}
+	if w.lsp != nil {
+		applyTextEdits(w.Editor, w.lsp.AdditionalEdits(idx))
+	}
+}
+
+// insertSnippet replaces the candidate's edit range, or the word before the caret, with its
+// expanded snippet and starts a snippet session on it.
+func (w *completionWrapper) insertSnippet(cand gvcode.CompletionCandidate) {
+	ed := w.Editor
+	r := cand.TextEdit.EditRange
+	start, end := r.Start.Runes, r.End.Runes
+	if start <= 0 && end <= 0 {
+		start, _ = ed.ConvertPos(r.Start.Line, r.Start.Column)
+		end, _ = ed.ConvertPos(r.End.Line, r.End.Column)
+	}
+	if r == (gvcode.EditRange{}) {
+		caret, _ := ed.Selection()
+		start, _ = wordBounds([]rune(ed.Text()), caret)
+		start, end = min(start, caret), caret
+	}
+	text := ed.Text()
+	line, _ := offsetLineCol(text, start)
+	lineText := strings.Split(text, "\n")[line]
+	wordStart, wordEnd := wordBounds([]rune(text), start)
+	ctx := snippetContext{
+		path:     w.path,
+		lang:     lspLanguageID(w.path),
+		line:     line,
+		lineText: lineText,
+		selected: ed.SelectedText(),
+	}
+	if wordStart < wordEnd {
+		ctx.word = string([]rune(text)[wordStart:wordEnd])
+	}
+	ed.SetCaret(start, end)
+	exp := expandSnippet(parseSnippet(cand.TextEdit.NewText), ctx.variable, leadingSpace(lineText))
+	w.snippet.insert(ed, w.theme, exp)
+	w.Cancel()
+}
+
+// commit accepts the selected candidate if ctx.Input, which was just typed, is one of its commit
+// characters: the character is taken out again, the candidate is inserted and the character is
+// typed after it.
+func (w *completionWrapper) commit(ctx gvcode.CompletionContext) bool {
+	if w.lsp == nil || ctx.Input == "" || !w.IsActive() || w.popup.selected >= w.popup.count {
+		return false
+	}
+	selected := w.popup.selected
+	if !slices.Contains(w.lsp.CommitCharacters(selected), ctx.Input) {
+		return false
+	}
+	ed := w.Editor
+	end := ctx.Position.Runes
+	ed.SetCaret(end-utf8.RuneCountInString(ctx.Input), end)
+	ed.Delete(1)
+	w.OnConfirm(selected)
+	ed.Insert(ctx.Input)
+	return true
+}
+
 // buildFileView creates a fileView for the given path with editor, syntax highlighting, and completion.
 // For non-existent paths (e.g. new files like "untitled-1"), content is empty.
-func (s *appState) buildFileView(th *theme.Theme, path string) fileView {
+func (s *appState) buildFileView(th *theme.Theme, path string) *fileView {
 	var content []byte
 	if _, err := os.Stat(path); err == nil {
 		// Path exists, read it
@@ -69,29 +164,37 @@ func (s *appState) buildFileView(th *theme.Theme, path string) fileView {
 	ed.WithOptions(
 		gvcode.WithFont(EditorFont()),
 		gvcode.WithLineNumber(true),
-		gvcode.WithLineNumberGutterGap(unit.Dp(12)),
-		gvcode.WithTextSize(unit.Sp(14)),
-		gvcode.WithLineHeight(0, 1.35),
-		gvcode.WithTabWidth(4),
+		gvcode.WithLineNumberGutterGap(editorGutterGap),
+		gvcode.WithTextSize(editorTextSize),
+		gvcode.WithLineHeight(0, editorLineHeight),
+		gvcode.WithTabWidth(editorTabWidth),
 	)
 	ed.SetText(string(content))
 
 	// Completion: prefer LSP if a server is configured for this file.
-	// Use completionWrapper so that typing "." or ":" cancels the current session and starts
-	// a new one, causing LSP Suggest() to be called again (e.g. for "fmt." -> Println, Printf).
+	// Use completionWrapper so that typing a server trigger character (e.g. ".") cancels the current
+	// session and starts a new one, causing LSP Suggest() to be called again (e.g. for "fmt." ->
+	// Println, Printf).
+	projectRoot := "."
 	defaultComp := &completion.DefaultCompletion{Editor: ed}
-	cm := &completionWrapper{
-		DefaultCompletion: defaultComp,
-		triggerChars:      map[string]bool{".": true, ":": true},
+	ranker := &lsp.CompletionRanker{History: &s.completionHistory}
+	snippet := &snippetSession{}
+	snippets := &snippetCompletor{
+		editor:  ed,
+		ranker:  ranker,
+		project: &projectCompletor{editor: ed, workspace: &s.workspaceIndex, ranker: ranker},
+		snippets: func() []userSnippet {
+			return s.userSnippets.forLanguage(s, lspLanguageID(path))
+		},
 	}
-	popup := completion.NewCompletionPopup(ed, cm)
-	popup.Theme = th.Material()
-	popup.TextSize = unit.Sp(12)
+	cm := &completionWrapper{DefaultCompletion: defaultComp, snippets: snippets, snippet: snippet, ranker: ranker, path: path, theme: th}
+	popup := newCompletionPopup(s, ed, cm, th)
+	popup.ranker = ranker
+	cm.popup = popup
 	var lspClient *lsp.Client
 	// Use absolute path so document URI matches what gopls sends in publishDiagnostics.
 	absPath, _ := filepath.Abs(path)
 	docURI := string(lsp.FileURI(absPath))
-	projectRoot := "."
 	if s.lspManager != nil {
 		c, err := s.lspManager.ClientFor(context.Background(), projectRoot, path)
 		if err != nil {
@@ -99,6 +202,7 @@ func (s *appState) buildFileView(th *theme.Theme, path string) fileView {
 		}
 		if err == nil && c != nil {
 			lspClient = c
+			cm.triggerChars = c.CompletionTriggerCharacters()
 			log.Printf("[LSP] registered diagnostics handler for %q", path)
 			c.RegisterDiagnosticsHandler(docURI, func(diagnostics []protocol.Diagnostic) {
 				log.Printf("[LSP] received diagnostics for %q: %v", path, diagnostics)
@@ -109,19 +213,21 @@ func (s *appState) buildFileView(th *theme.Theme, path string) fileView {
 			if err := c.DidOpen(context.Background(), protocol.DocumentURI(docURI), lspLanguageID(path), 1, string(content)); err != nil {
 				log.Printf("[LSP] failed to send didOpen for %q: %v", path, err)
 			}
-			if err := cm.AddCompletor(&lsp.Completor{Client: c, DocURI: protocol.DocumentURI(docURI), Editor: ed, ProjectRoot: projectRoot}, popup); err != nil {
-				log.Printf("[LSP] failed to add completor for %q: %v", path, err)
-			}
+			completor := &lsp.Completor{Client: c, DocURI: protocol.DocumentURI(docURI), Editor: ed, ProjectRoot: projectRoot, Ranker: ranker}
+			snippets.lsp, snippets.project, cm.lsp = completor, nil, completor
+			popup.lsp, popup.lang = completor, lspLanguageID(path)
 			log.Printf("[LSP] added completor for %q", path)
 		}
 	}
+	// User snippets are offered with the server's candidates, or without a server with the
+	// identifiers of the project's workspace index.
+	if err := cm.AddCompletor(snippets, popup); err != nil {
+		log.Printf("failed to add completor for %q: %v", path, err)
+	}
 	ed.WithOptions(gvcode.WithAutoCompletion(cm))
 
 	// Build color scheme from chroma style and apply syntax highlighting
-	chromaStyle := styles.Get("dracula")
-	if chromaStyle == nil {
-		chromaStyle = styles.Fallback
-	}
+	chromaStyle := editorChromaStyle()
 	gvScheme := buildColorSchemeFromChroma(th.Material(), chromaStyle)
 	ed.WithOptions(gvcode.WithColorScheme(gvScheme))
 
@@ -132,13 +238,122 @@ func (s *appState) buildFileView(th *theme.Theme, path string) fileView {
 			return nil
 		})
 
+	// Ctrl+K / Cmd+K shows hover info at the caret; Escape hides it and signature help. Mouse
+	// hover is handled from the editor's HoverEvent in Layout.
+	hover := &hoverPopup{}
+	sig := &signaturePopup{}
+	hover.content.OnLink = s.openLink
+	ed.RegisterCommand(&hoverCmdTag, key.Filter{Name: "K", Required: key.ModShortcut},
+		func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			if lspClient != nil {
+				line, col := ed.CaretPos()
+				runeOff, _ := ed.ConvertPos(line, col)
+				hover.request(s, lspClient, protocol.DocumentURI(docURI), ed.Text(), runeOff, line, col)
+			}
+			return nil
+		})
+	ed.RegisterCommand(&hoverCmdTag, key.Filter{Name: key.NameEscape},
+		func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			hover.hide()
+			sig.hide()
+			return nil
+		})
+
+	// F12 goes to the definition of the symbol at the caret; with modifiers it goes to the
+	// declaration, implementation or type definition instead (see navKindForKey).
+	// Shift+F12 lists all references in the references panel.
+	gotoAtCaret := func(kind navKind) {
+		if lspClient == nil {
+			return
+		}
+		line, col := ed.CaretPos()
+		runeOff, _ := ed.ConvertPos(line, col)
+		s.gotoSymbol(kind, lspClient, protocol.DocumentURI(docURI), ed.Text(), runeOff)
+	}
+	ed.RegisterCommand(&navCmdTag, key.Filter{Name: key.NameF12, Optional: key.ModShortcut | key.ModShift | key.ModAlt},
+		func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			if lspClient == nil {
+				return nil
+			}
+			if evt.Modifiers == key.ModShift {
+				line, col := ed.CaretPos()
+				runeOff, _ := ed.ConvertPos(line, col)
+				s.findReferences(lspClient, protocol.DocumentURI(docURI), ed.Text(), runeOff)
+				return nil
+			}
+			gotoAtCaret(navKindForKey(evt.Modifiers))
+			return nil
+		})
+	// Shift+Alt+H shows the call hierarchy of the function at the caret, Ctrl+Shift+Alt+H
+	// (Cmd+Shift+Alt+H) the type hierarchy of the type at the caret. They share one command:
+	// the editor only checks the last command registered for a key name, and "T" is taken by
+	// the symbol search.
+	ed.RegisterCommand(&hierarchyCmdTag, key.Filter{Name: "H", Required: key.ModShift | key.ModAlt, Optional: key.ModShortcut},
+		func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			if lspClient != nil {
+				kind := hierarchyIncoming
+				if evt.Modifiers.Contain(key.ModShortcut) {
+					kind = hierarchySubtypes
+				}
+				line, col := ed.CaretPos()
+				runeOff, _ := ed.ConvertPos(line, col)
+				s.showHierarchy(kind, lspClient, protocol.DocumentURI(docURI), ed.Text(), runeOff)
+			}
+			return nil
+		})
+	// F2 renames the symbol at the caret across the workspace.
+	ed.RegisterCommand(&renameCmdTag, key.Filter{Name: key.NameF2},
+		func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			if lspClient != nil {
+				line, col := ed.CaretPos()
+				runeOff, _ := ed.ConvertPos(line, col)
+				s.startRename(lspClient, protocol.DocumentURI(docURI), ed.Text(), runeOff)
+			}
+			return nil
+		})
+	// Ctrl+. (Cmd+.) lists the code actions at the caret; so does clicking the lightbulb shown in
+	// the gutter when the caret is inside a diagnostic.
+	ed.RegisterCommand(&codeActionCmdTag, key.Filter{Name: ".", Required: key.ModShortcut},
+		func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			if lspClient != nil {
+				s.showCodeActions(lspClient, protocol.DocumentURI(docURI), ed, s.currentDiag[path])
+			}
+			return nil
+		})
+	// Ctrl+T (Cmd+T) searches the symbols of the whole workspace; so does the Search button.
+	ed.RegisterCommand(&symbolSearchCmdTag, key.Filter{Name: "T", Required: key.ModShortcut},
+		func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			s.symbolSearch.open()
+			return nil
+		})
+	bulb := &lightbulb{}
+	// Inlay hints are drawn after the end of their line; the server can ask for them to be refreshed.
+	inlay := &inlayHints{}
+	if lspClient != nil {
+		lspClient.RegisterRefreshHandler(lsp.MethodWorkspaceInlayHintRefresh, docURI, func() {
+			s.runOnUI(func() { inlay.request(s, lspClient, protocol.DocumentURI(docURI), ed) })
+		})
+	}
+	// Code lenses are drawn above their line; clicking one runs its command.
+	lenses := &codeLenses{}
+	if lspClient != nil {
+		lspClient.RegisterRefreshHandler(protocol.MethodCodeLensRefresh, docURI, func() {
+			s.runOnUI(func() { lenses.request(s, lspClient, protocol.DocumentURI(docURI), ed) })
+		})
+	}
+	// The occurrences of the symbol under the caret are highlighted once the caret rests.
+	occurrences := &occurrenceHighlights{caret: -1}
+	// Ctrl+click (Cmd+click) goes to the definition of the clicked symbol.
+	click := &ctrlClick{}
+
+	// Syntax highlighting: chroma, refined by the server's semantic tokens when it has them.
 	originalContent := string(content)
-	tokens := chromaTokensToGvcode(path, originalContent, chromaStyle)
-	if len(tokens) > 0 {
-		ed.SetSyntaxTokens(tokens...)
+	hl := newHighlighter(path, chromaStyle, gvScheme.Scopes())
+	hl.apply(ed)
+	if lspClient != nil {
+		hl.schedule(s, lspClient, protocol.DocumentURI(docURI), ed)
 	}
 
-	docVersion := int32(1)
 	onChange := func(currentContent string) {
 		if tab := s.openTabs[path]; tab != nil {
 			fv := s.openFiles[path]
@@ -150,7 +365,8 @@ func (s *appState) buildFileView(th *theme.Theme, path string) fileView {
 		}
 	}
 
-	fv := fileView{
+	var fv *fileView
+	fv = &fileView{
 		Title:           path,
 		Path:            path,
 		Editor:          ed,
@@ -158,7 +374,8 @@ func (s *appState) buildFileView(th *theme.Theme, path string) fileView {
 		OnChange:        onChange,
 		LSPClient:       lspClient,
 		LSPDocURI:       docURI,
-		DocVersion:      docVersion,
+		DocVersion:      1,
+		lspText:         originalContent,
 		Layout: func(gtx layout.Context, th *theme.Theme) layout.Dimensions {
 			// Apply any pending LSP diagnostics (from background callback)
 			s.pendingDiagMu.Lock()
@@ -172,44 +389,103 @@ func (s *appState) buildFileView(th *theme.Theme, path string) fileView {
 				s.currentDiag[path] = make([]protocol.Diagnostic, len(pending))
 				copy(s.currentDiag[path], pending)
 			}
+			changed := false
 			for {
 				evt, ok := ed.Update(gtx)
 				if !ok {
 					break
 				}
+				if hv, isHover := evt.(gvcode.HoverEvent); isHover {
+					if hv.IsCancel {
+						hover.cancel()
+					} else if lspClient != nil {
+						hover.request(s, lspClient, protocol.DocumentURI(docURI), ed.Text(), hv.Pos.Runes, hv.Pos.Line, hv.Pos.Column)
+					}
+				}
 				if _, isChange := evt.(gvcode.ChangeEvent); isChange {
+					changed = true
+					hover.hide()
 					if onChange != nil {
 						onChange(ed.Text())
 					}
-					if lspClient != nil {
-						docVersion++
-						text := ed.Text()
-						_ = lspClient.DidChange(context.Background(), protocol.DocumentURI(docURI), docVersion, text)
-					}
+					fv.syncLSP()
 					ed.OnTextEdit()
-					tokens := chromaTokensToGvcode(path, ed.Text(), chromaStyle)
-					if len(tokens) > 0 {
-						ed.SetSyntaxTokens(tokens...)
+					hl.apply(ed)
+					if lspClient != nil {
+						hl.schedule(s, lspClient, protocol.DocumentURI(docURI), ed)
 					}
 				}
 			}
+			if lspClient != nil {
+				sig.update(s, lspClient, protocol.DocumentURI(docURI), ed, changed)
+				inlay.update(s, lspClient, protocol.DocumentURI(docURI), ed, changed)
+				lenses.update(s, lspClient, protocol.DocumentURI(docURI), ed, changed)
+			}
+			occurrences.update(s, th, lspClient, protocol.DocumentURI(docURI), ed, changed)
+			snippet.update(changed)
+			// The editor has moved the caret to the clicked position by now.
+			if click.Update(gtx) {
+				gotoAtCaret(navDefinition)
+			}
 			return layout.UniformInset(unit.Dp(8)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 				dims := ed.Layout(gtx, th.Material().Shaper)
-				// Show diagnostic hover when caret is inside an LSP diagnostic range.
-				if diag := diagnosticAtCaret(ed, s.currentDiag[path]); diag != nil {
+				click.Layout(gtx, dims.Size)
+				inlay.Layout(gtx, th, ed, dims.Size)
+				if lens := lenses.Layout(gtx, th, ed, dims.Size); lens != nil && lspClient != nil {
+					s.runCodeLens(lspClient, lens)
+				}
+				// Hover info takes precedence over the diagnostic tooltip at the caret.
+				diag := diagnosticAtCaret(ed, s.currentDiag[path])
+				if hover.visible {
+					_, p := ed.ConvertPos(hover.line, hover.col)
+					ed.PaintOverlay(gtx, image.Pt(int(p.X), int(p.Y)), func(gtx layout.Context) layout.Dimensions {
+						return hover.Layout(gtx, th)
+					})
+				} else if diag != nil {
+					// Show diagnostic hover when caret is inside an LSP diagnostic range.
 					caret := ed.CaretCoords()
 					pos := image.Pt(int(caret.X), int(caret.Y))
 					ed.PaintOverlay(gtx, pos, func(gtx layout.Context) layout.Dimensions {
 						return layoutDiagnosticTooltip(gtx, th, diag)
 					})
 				}
+				if diag != nil && lspClient != nil && lspClient.Supports(protocol.MethodTextDocumentCodeAction) {
+					if bulb.Layout(gtx, ed) {
+						s.showCodeActions(lspClient, protocol.DocumentURI(docURI), ed, s.currentDiag[path])
+					}
+				}
+				sig.Layout(gtx, th, ed, int(float32(gtx.Sp(editorTextSize))*editorLineHeight))
+				snippet.Layout(gtx)
 				return dims
 			})
 		},
 	}
+
+	// Shift+Alt+F formats the document, or just the selection if the server can format ranges.
+	ed.RegisterCommand(&formatCmdTag, key.Filter{Name: "F", Required: key.ModShift | key.ModAlt},
+		func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			s.formatDocument(fv)
+			return nil
+		})
 	return fv
 }
 
+// syncLSP sends didChange if the editor text differs from what the server last saw.
+// Edits made outside the focused editor (e.g. a rename touching a background tab) call it
+// directly, so the server is up to date before the tab is laid out again.
+func (fv *fileView) syncLSP() {
+	if fv.LSPClient == nil {
+		return
+	}
+	text := fv.Editor.Text()
+	if text == fv.lspText {
+		return
+	}
+	fv.DocVersion++
+	_ = fv.LSPClient.DidChange(context.Background(), protocol.DocumentURI(fv.LSPDocURI), fv.DocVersion, fv.lspText, text)
+	fv.lspText = text
+}
+
 // lspLanguageID returns a simple language ID from file extension for LSP.
 func lspLanguageID(path string) string {
 	ext := strings.ToLower(filepath.Ext(path))
@@ -402,20 +678,41 @@ func buildColorSchemeFromChroma(mat *material.Theme, chromaStyle *chroma.Style)
 		chroma.Operator, chroma.Punctuation,
 		chroma.Text, chroma.Whitespace,
 	} {
-		entry := chromaStyle.Get(tt)
-		if entry.Colour.IsSet() {
-			fg := gvcolor.MakeColor(color.NRGBA{
-				R: entry.Colour.Red(),
-				G: entry.Colour.Green(),
-				B: entry.Colour.Blue(),
-				A: 255,
-			})
-			cs.AddStyle(syntax.StyleScope(tt.String()), 0, fg, gvcolor.Color{})
+		if c, ok := chromaTokenColor(chromaStyle, tt); ok {
+			cs.AddStyle(syntax.StyleScope(tt.String()), 0, gvcolor.MakeColor(c), gvcolor.Color{})
+		}
+	}
+	// Semantic tokens from the language server take the colors of the closest chroma token type.
+	for _, st := range semanticTokenStyles {
+		if c, ok := chromaTokenColor(chromaStyle, st.token); ok {
+			cs.AddStyle(st.scope, 0, gvcolor.MakeColor(c), gvcolor.Color{})
 		}
 	}
 	return cs
 }
 
+// editorChromaStyle returns the chroma style used for the editor and for highlighted code in popups.
+func editorChromaStyle() *chroma.Style {
+	if st := styles.Get("dracula"); st != nil {
+		return st
+	}
+	return styles.Fallback
+}
+
+// chromaTokenColor returns the foreground color the chroma style assigns to tt, if any.
+func chromaTokenColor(chromaStyle *chroma.Style, tt chroma.TokenType) (color.NRGBA, bool) {
+	entry := chromaStyle.Get(tt)
+	if !entry.Colour.IsSet() {
+		return color.NRGBA{}, false
+	}
+	return color.NRGBA{
+		R: entry.Colour.Red(),
+		G: entry.Colour.Green(),
+		B: entry.Colour.Blue(),
+		A: 255,
+	}, true
+}
+
 // chromaTokensToGvcode tokenizes content with chroma and returns gvcode syntax tokens.
 func chromaTokensToGvcode(filename, content string, _ *chroma.Style) []syntax.Token {
 	lexer := lexers.Match(filename)
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 
 	"gioui.org/layout"
 	"gioui.org/unit"
@@ -100,6 +101,7 @@ func (s *appState) openFileAsTab(path string) {
 		if fv, ok := s.openFiles[p]; ok && fv.LSPClient != nil {
 			_ = fv.LSPClient.DidClose(context.Background(), protocol.DocumentURI(fv.LSPDocURI))
 			fv.LSPClient.UnregisterDiagnosticsHandler(fv.LSPDocURI)
+			fv.LSPClient.UnregisterRefreshHandlers(fv.LSPDocURI)
 		}
 		delete(s.openFiles, p)
 		delete(s.openTabs, p)
@@ -117,6 +119,24 @@ func (s *appState) openFileAsTab(path string) {
 	s.tabToPath[t] = path
 }
 
+// projectPath returns p relative to the working directory when it lies inside the project, so
+// tabs opened from LSP locations (absolute paths) share keys with tabs opened from the file tree.
+func projectPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return abs
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return abs
+	}
+	return rel
+}
+
 // nextUntitledPath returns a unique path for a new file (e.g. "untitled-1", "untitled-2").
 func (s *appState) nextUntitledPath() string {
 	for i := 1; ; i++ {
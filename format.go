@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/format"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mirzakhany/void/lsp"
+	"go.lsp.dev/protocol"
+)
+
+// formatCmdTag is the tag for the Shift+Alt+F (format document) command registered with the editor.
+var formatCmdTag struct{}
+
+// onSaveTimeout bounds how long saving waits for the server to format the document or organize
+// its imports.
+const onSaveTimeout = 2 * time.Second
+
+// maxDiffCells bounds the size of the table lineEdits uses; larger changes become a single edit.
+const maxDiffCells = 1 << 20
+
+// formatRequest is what formatting a document needs, captured on the UI goroutine so the request
+// can run in the background.
+type formatRequest struct {
+	client    *lsp.Client
+	docURI    protocol.DocumentURI
+	path      string
+	text      string
+	selection *protocol.Range // format just this range; nil for the whole document
+}
+
+// newFormatRequest captures fv's document. With useSelection, a non-empty selection is formatted
+// on its own if the server supports range formatting.
+func newFormatRequest(fv *fileView, useSelection bool) formatRequest {
+	req := formatRequest{
+		client: fv.LSPClient,
+		docURI: protocol.DocumentURI(fv.LSPDocURI),
+		path:   fv.Path,
+		text:   fv.Editor.Text(),
+	}
+	if start, end := fv.Editor.Selection(); useSelection && start != end {
+		start, end = min(start, end), max(start, end)
+		req.selection = &protocol.Range{
+			Start: lsp.RuneOffsetToPosition(req.text, start),
+			End:   lsp.RuneOffsetToPosition(req.text, end),
+		}
+	}
+	return req
+}
+
+// edits returns the edits that format the document. Servers are asked first; Go files fall back
+// to go/format when there is no server that formats or it fails.
+func (r formatRequest) edits(ctx context.Context) ([]protocol.TextEdit, error) {
+	options := protocol.FormattingOptions{TabSize: editorTabWidth, InsertSpaces: false}
+	if r.client != nil {
+		var edits []protocol.TextEdit
+		var err error
+		switch {
+		case r.selection != nil && r.client.Supports(protocol.MethodTextDocumentRangeFormatting):
+			edits, err = r.client.RangeFormatting(ctx, r.docURI, *r.selection, options)
+		case r.client.Supports(protocol.MethodTextDocumentFormatting):
+			edits, err = r.client.Formatting(ctx, r.docURI, options)
+		default:
+			err = errors.ErrUnsupported
+		}
+		if err == nil || !isGoFile(r.path) {
+			return edits, err
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			log.Printf("[LSP] formatting failed for %q, using go/format: %v", r.path, err)
+		}
+	}
+	if isGoFile(r.path) {
+		return goFormatEdits(r.text)
+	}
+	return nil, fmt.Errorf("no formatter for %s", filepath.Base(r.path))
+}
+
+// formatDocument formats fv's document, or its selection, in the background and applies the
+// result unless the document changed in the meantime.
+func (s *appState) formatDocument(fv *fileView) {
+	req := newFormatRequest(fv, true)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		edits, err := req.edits(ctx)
+		s.runOnUI(func() {
+			if err != nil {
+				log.Printf("[LSP] format %q: %v", req.path, err)
+				s.notifications.add(fmt.Sprintf("Format Document: %v", err))
+				return
+			}
+			if fv.Editor.Text() != req.text {
+				return
+			}
+			s.applyFormatEdits(fv, edits)
+		})
+	}()
+}
+
+// formatBeforeSave formats fv's document synchronously; it is called by saveCurrentFile before
+// the text is written.
+func (s *appState) formatBeforeSave(fv *fileView) {
+	ctx, cancel := context.WithTimeout(context.Background(), onSaveTimeout)
+	defer cancel()
+	edits, err := newFormatRequest(fv, false).edits(ctx)
+	if err != nil {
+		log.Printf("[LSP] format on save %q: %v", fv.Path, err)
+		return
+	}
+	s.applyFormatEdits(fv, edits)
+}
+
+// applyFormatEdits applies formatting edits to fv's buffer and syncs the result to the server.
+func (s *appState) applyFormatEdits(fv *fileView, edits []protocol.TextEdit) {
+	if len(edits) == 0 {
+		return
+	}
+	applyTextEdits(fv.Editor, edits)
+	if fv.OnChange != nil {
+		fv.OnChange(fv.Editor.Text())
+	}
+	fv.syncLSP()
+}
+
+// isGoFile reports whether path is a Go source file.
+func isGoFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".go")
+}
+
+// goFormatEdits formats Go source with go/format and returns the changes as edits.
+func goFormatEdits(text string) ([]protocol.TextEdit, error) {
+	src, err := format.Source([]byte(text))
+	if err != nil {
+		return nil, err
+	}
+	return lineEdits(text, string(src)), nil
+}
+
+// lineEdits returns edits that turn oldText into newText, one per run of changed lines, so
+// applying them leaves the caret in place unless its own line changed.
+func lineEdits(oldText, newText string) []protocol.TextEdit {
+	a, b := splitLinesKeepEnds(oldText), splitLinesKeepEnds(newText)
+	// offsets[i] is the rune offset of line i in oldText.
+	offsets := make([]int, len(a)+1)
+	for i, line := range a {
+		offsets[i+1] = offsets[i] + utf8.RuneCountInString(line)
+	}
+	edit := func(i0, i1, j0, j1 int) protocol.TextEdit {
+		return protocol.TextEdit{
+			Range: protocol.Range{
+				Start: lsp.RuneOffsetToPosition(oldText, offsets[i0]),
+				End:   lsp.RuneOffsetToPosition(oldText, offsets[i1]),
+			},
+			NewText: strings.Join(b[j0:j1], ""),
+		}
+	}
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	n, m := len(a)-prefix-suffix, len(b)-prefix-suffix
+	if n == 0 && m == 0 {
+		return nil
+	}
+	if (n+1)*(m+1) > maxDiffCells {
+		return []protocol.TextEdit{edit(prefix, prefix+n, prefix, prefix+m)}
+	}
+
+	// lcs[i*(m+1)+j] is the length of the longest common subsequence of the changed lines
+	// a[prefix+i:] and b[prefix+j:].
+	lcs := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[prefix+i] == b[prefix+j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else {
+				lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+			}
+		}
+	}
+	same := func(i, j int) bool { return i < n && j < m && a[prefix+i] == b[prefix+j] }
+	var edits []protocol.TextEdit
+	for i, j := 0, 0; i < n || j < m; {
+		if same(i, j) {
+			i, j = i+1, j+1
+			continue
+		}
+		i0, j0 := i, j
+		for (i < n || j < m) && !same(i, j) {
+			if j < m && (i == n || lcs[i*(m+1)+j+1] >= lcs[(i+1)*(m+1)+j]) {
+				j++
+			} else {
+				i++
+			}
+		}
+		edits = append(edits, edit(prefix+i0, prefix+i, prefix+j0, prefix+j))
+	}
+	return edits
+}
+
+// splitLinesKeepEnds splits s after each "\n", keeping the line endings.
+func splitLinesKeepEnds(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
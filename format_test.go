@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mirzakhany/void/lsp"
+)
+
+func TestLineEdits(t *testing.T) {
+	// numbered returns n lines "<prefix>0\n", "<prefix>1\n", ...
+	numbered := func(prefix string, n int) string {
+		var b strings.Builder
+		for i := range n {
+			fmt.Fprintf(&b, "%s%d\n", prefix, i)
+		}
+		return b.String()
+	}
+	tests := []struct {
+		name             string
+		oldText, newText string
+		edits            int // number of edits expected
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", 0},
+		{"both empty", "", "", 0},
+		{"empty old", "", "a\nb\n", 1},
+		{"empty new", "a\nb\n", "", 1},
+		{"trailing newline added", "a\nb", "a\nb\n", 1},
+		{"trailing newline removed", "a\nb\n", "a\nb", 1},
+		{"line changed", "a\nb\nc\n", "a\nB\nc\n", 1},
+		{"line inserted", "a\nc\n", "a\nb\nc\n", 1},
+		{"line deleted", "a\nb\nc\n", "a\nc\n", 1},
+		{"separate changes", "a\nb\nc\nd\ne\n", "A\nb\nc\nd\nE\n", 2},
+		{"non-ASCII", "héllo\n𝒳\nwörld\n", "héllo\n𝒴\nwörld\n", 1},
+		{"CRLF", "a\r\nb\r\n", "a\r\nB\r\n", 1},
+		{"over maxDiffCells", numbered("old", 1100), numbered("new", 1100), 1},
+	}
+	for _, tt := range tests {
+		edits := lineEdits(tt.oldText, tt.newText)
+		if got := lsp.ApplyTextEdits(tt.oldText, edits); got != tt.newText {
+			t.Errorf("%s: applying the edits gives %q; want %q", tt.name, got, tt.newText)
+		}
+		if len(edits) != tt.edits {
+			t.Errorf("%s: got %d edits; want %d", tt.name, len(edits), tt.edits)
+		}
+	}
+}
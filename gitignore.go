@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is a pattern of a .gitignore file.
+type ignoreRule struct {
+	base     string // slash-separated directory of the .gitignore, relative to the root
+	pattern  string
+	negate   bool // "!pattern" re-includes what an earlier rule ignored
+	dirOnly  bool // "pattern/" only matches directories
+	anchored bool // the pattern contains a slash, so it is matched against the path from base
+}
+
+// gitignore decides which paths of a directory tree the .gitignore files in it exclude. Rules are
+// added per directory as the tree is walked, so a directory's rules must be loaded before its
+// entries are matched. The zero value ignores nothing.
+type gitignore struct {
+	rules []ignoreRule
+}
+
+// load adds the rules of dir's .gitignore, if there is one. dir is relative to the root.
+func (g *gitignore) load(root, dir string) {
+	f, err := os.Open(filepath.Join(root, dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	base := filepath.ToSlash(filepath.Clean(dir))
+	if base == "." {
+		base = ""
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate, line = true, line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored, line = true, strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		g.rules = append(g.rules, rule)
+	}
+}
+
+// ignored reports whether the path rel, relative to the root, is excluded. The last rule that
+// matches decides, as in git.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	ignored := false
+	for _, r := range g.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			sub = rel[len(r.base)+1:]
+		}
+		if r.matches(sub) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// matches reports whether the rule's pattern matches sub, the path relative to the rule's
+// directory. Unanchored patterns match the last element; "**" matches any number of elements.
+func (r ignoreRule) matches(sub string) bool {
+	if !r.anchored {
+		ok, _ := path.Match(r.pattern, path.Base(sub))
+		return ok
+	}
+	return matchGlobPath(strings.Split(r.pattern, "/"), strings.Split(sub, "/"))
+}
+
+// matchGlobPath matches path elements against pattern elements, where a "**" element matches
+// zero or more path elements.
+func matchGlobPath(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchGlobPath(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitignore(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":     "# comment\n*.log\n!keep.log\nbuild/\n/vendor\ndocs/**/*.tmp\n\\#hash\n",
+		"sub/.gitignore": "local.txt\n/only-here\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var g gitignore
+	g.load(root, ".")
+	g.load(root, "sub")
+	g.load(root, "missing")
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"x.log", false, true},
+		{"a/b/x.log", false, true},
+		{"keep.log", false, false},
+		{"a/keep.log", false, false},
+		{"x.go", false, false},
+		{"# comment", false, false},
+		{"#hash", false, true},
+		// Trailing slash: directories only.
+		{"build", true, true},
+		{"build", false, false},
+		{"a/build", true, true},
+		// Leading slash: anchored to the .gitignore's directory.
+		{"vendor", true, true},
+		{"a/vendor", true, false},
+		// "**" matches zero or more directories.
+		{"docs/x.tmp", false, true},
+		{"docs/a/b/x.tmp", false, true},
+		{"other/x.tmp", false, false},
+		// Rules of a nested .gitignore apply below it only.
+		{"sub/local.txt", false, true},
+		{"sub/deep/local.txt", false, true},
+		{"local.txt", false, false},
+		{"sub/only-here", false, true},
+		{"sub/deep/only-here", false, false},
+		{"subway/local.txt", false, false},
+	}
+	for _, tt := range tests {
+		if got := g.ignored(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("ignored(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestMatchGlobPath(t *testing.T) {
+	tests := []struct {
+		pattern, path []string
+		want          bool
+	}{
+		{[]string{"a", "b"}, []string{"a", "b"}, true},
+		{[]string{"a", "b"}, []string{"a", "b", "c"}, false},
+		{[]string{"a", "*"}, []string{"a", "x"}, true},
+		{[]string{"**", "c"}, []string{"c"}, true},
+		{[]string{"**", "c"}, []string{"a", "b", "c"}, true},
+		{[]string{"a", "**"}, []string{"a"}, true},
+		{[]string{"a", "**"}, []string{"a", "b", "c"}, true},
+		{[]string{"a", "**", "c"}, []string{"a", "b", "d"}, false},
+	}
+	for _, tt := range tests {
+		if got := matchGlobPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchGlobPath(%v, %v) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -4,29 +4,29 @@ go 1.25.1
 
 require (
 	gioui.org v0.9.0
+	gioui.org/x v0.9.0
 	github.com/alecthomas/chroma/v2 v2.23.1
 	github.com/chapar-rest/uikit v0.0.0-20260218202142-420d694c6b1c
 	github.com/oligo/gvcode v0.4.4
+	go.lsp.dev/jsonrpc2 v0.10.0
+	go.lsp.dev/protocol v0.12.0
+	go.lsp.dev/uri v0.3.0
+	go.uber.org/zap v1.21.0
+	golang.org/x/exp/shiny v0.0.0-20250408133849-7e4ce0ab07d0
 )
 
 require (
 	gioui.org/shader v1.0.8 // indirect
-	gioui.org/x v0.9.0 // indirect
 	github.com/dlclark/regexp2 v1.11.5 // indirect
 	github.com/go-text/typesetting v0.3.0 // indirect
 	github.com/inkeliz/giosvg v0.0.0-20240821232107-3208d4350d55 // indirect
 	github.com/rdleal/intervalst v1.4.1 // indirect
 	github.com/segmentio/asm v1.1.3 // indirect
 	github.com/segmentio/encoding v0.3.4 // indirect
-	go.lsp.dev/jsonrpc2 v0.10.0 // indirect
 	go.lsp.dev/pkg v0.0.0-20210717090340-384b27a52fb2 // indirect
-	go.lsp.dev/protocol v0.12.0 // indirect
-	go.lsp.dev/uri v0.3.0 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/multierr v1.8.0 // indirect
-	go.uber.org/zap v1.21.0 // indirect
 	golang.org/x/exp v0.0.0-20250408133849-7e4ce0ab07d0 // indirect
-	golang.org/x/exp/shiny v0.0.0-20250408133849-7e4ce0ab07d0 // indirect
 	golang.org/x/image v0.26.0 // indirect
 	golang.org/x/net v0.0.0-20210924151903-3ad01bbaa167 // indirect
 	golang.org/x/sys v0.33.0 // indirect
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/chapar-rest/uikit/button"
+	"github.com/chapar-rest/uikit/icons"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/mirzakhany/void/lsp"
+	"go.lsp.dev/protocol"
+)
+
+// hierarchyCmdTag is the tag for the Shift+Alt+H (call hierarchy) and Ctrl+Shift+Alt+H (type
+// hierarchy) command registered with the editor.
+var hierarchyCmdTag struct{}
+
+// hierarchyKind is the relation a hierarchy panel follows. Opposite directions differ in the
+// lowest bit, see opposite.
+type hierarchyKind int
+
+const (
+	hierarchyIncoming hierarchyKind = iota
+	hierarchyOutgoing
+	hierarchySupertypes
+	hierarchySubtypes
+)
+
+func (k hierarchyKind) String() string {
+	switch k {
+	case hierarchyOutgoing:
+		return "Outgoing calls"
+	case hierarchySupertypes:
+		return "Supertypes"
+	case hierarchySubtypes:
+		return "Subtypes"
+	default:
+		return "Incoming calls"
+	}
+}
+
+// opposite returns the other direction of the same hierarchy.
+func (k hierarchyKind) opposite() hierarchyKind {
+	return k ^ 1
+}
+
+// calls reports whether k is a direction of the call hierarchy.
+func (k hierarchyKind) calls() bool {
+	return k == hierarchyIncoming || k == hierarchyOutgoing
+}
+
+// prepareMethod returns the request that finds the hierarchy items at a position.
+func (k hierarchyKind) prepareMethod() string {
+	if k.calls() {
+		return protocol.MethodTextDocumentPrepareCallHierarchy
+	}
+	return lsp.MethodTextDocumentPrepareTypeHierarchy
+}
+
+// hierarchyNode is an item in the hierarchy panel. Its children are requested when it is first
+// expanded.
+type hierarchyNode struct {
+	item lsp.HierarchyItem
+	// loc is opened when the node is clicked: the call for incoming calls, the item otherwise.
+	loc   protocol.Location
+	calls int // number of calls, for call hierarchy nodes below the root
+	depth int
+	// expanded nodes show their children; loaded nodes have them.
+	expanded, loaded, loading bool
+	children                  []*hierarchyNode
+	toggle, click             widget.Clickable
+}
+
+// hierarchyPanel is the bottom panel showing a call or type hierarchy as a tree that expands
+// lazily: every node asks the server for its callers, callees, supertypes or subtypes when it
+// is first expanded.
+type hierarchyPanel struct {
+	visible bool
+	kind    hierarchyKind
+	client  *lsp.Client
+	roots   []*hierarchyNode
+	current *hierarchyNode // last opened node, highlighted in the list
+	// gen is bumped whenever the tree is replaced so responses for the old one are dropped.
+	gen   int
+	list  widget.List
+	flip  widget.Clickable // switches to the opposite direction
+	close widget.Clickable
+}
+
+// showHierarchy asks the server for the hierarchy items of the symbol at runeOff in text and shows
+// their relations of the given kind in the hierarchy panel.
+func (s *appState) showHierarchy(kind hierarchyKind, c *lsp.Client, docURI protocol.DocumentURI, text string, runeOff int) {
+	method := kind.prepareMethod()
+	if !c.Supports(method) {
+		log.Printf("[LSP] server does not support %s", method)
+		return
+	}
+	pos := lsp.RuneOffsetToPosition(text, runeOff)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		var items []lsp.HierarchyItem
+		var err error
+		if kind.calls() {
+			items, err = c.PrepareCallHierarchy(ctx, docURI, pos.Line, pos.Character)
+		} else {
+			items, err = c.PrepareTypeHierarchy(ctx, docURI, pos.Line, pos.Character)
+		}
+		if err != nil {
+			log.Printf("[LSP] %s failed for %q: %v", method, docURI, err)
+			return
+		}
+		if len(items) == 0 {
+			log.Printf("[LSP] %s: no results", method)
+			return
+		}
+		s.runOnUI(func() {
+			s.hierarchy.show(s, kind, c, items)
+		})
+	}()
+}
+
+// show replaces the panel's tree with items as roots and expands the first one.
+func (p *hierarchyPanel) show(s *appState, kind hierarchyKind, c *lsp.Client, items []lsp.HierarchyItem) {
+	p.visible = true
+	p.kind = kind
+	p.client = c
+	p.gen++
+	p.roots = make([]*hierarchyNode, len(items))
+	for i, item := range items {
+		p.roots[i] = &hierarchyNode{item: item, loc: protocol.Location{URI: item.URI, Range: item.SelectionRange}}
+	}
+	p.current = nil
+	p.list.Position = layout.Position{}
+	p.expand(s, p.roots[0])
+}
+
+// expand shows n's children, requesting them first if it has not got them yet.
+func (p *hierarchyPanel) expand(s *appState, n *hierarchyNode) {
+	n.expanded = true
+	if n.loaded || n.loading {
+		return
+	}
+	n.loading = true
+	c, kind, gen := p.client, p.kind, p.gen
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		children, err := hierarchyChildren(ctx, c, kind, n)
+		s.runOnUI(func() {
+			if gen != p.gen {
+				return
+			}
+			n.loading = false
+			if err != nil {
+				log.Printf("[LSP] %s of %q failed: %v", kind, n.item.Name, err)
+				n.expanded = false
+				return
+			}
+			n.loaded = true
+			n.children = children
+		})
+	}()
+}
+
+// hierarchyChildren requests the relatives of n's item in the direction kind.
+func hierarchyChildren(ctx context.Context, c *lsp.Client, kind hierarchyKind, n *hierarchyNode) ([]*hierarchyNode, error) {
+	var children []*hierarchyNode
+	switch kind {
+	case hierarchyIncoming, hierarchyOutgoing:
+		var calls []lsp.HierarchyCall
+		var err error
+		if kind == hierarchyIncoming {
+			calls, err = c.IncomingCalls(ctx, n.item)
+		} else {
+			calls, err = c.OutgoingCalls(ctx, n.item)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, call := range calls {
+			child := &hierarchyNode{item: call.Item, calls: len(call.Ranges), depth: n.depth + 1}
+			child.loc = protocol.Location{URI: call.Item.URI, Range: call.Item.SelectionRange}
+			if kind == hierarchyIncoming && len(call.Ranges) > 0 {
+				child.loc.Range = call.Ranges[0]
+			}
+			children = append(children, child)
+		}
+	default:
+		var items []lsp.HierarchyItem
+		var err error
+		if kind == hierarchySupertypes {
+			items, err = c.Supertypes(ctx, n.item)
+		} else {
+			items, err = c.Subtypes(ctx, n.item)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			children = append(children, &hierarchyNode{
+				item:  item,
+				loc:   protocol.Location{URI: item.URI, Range: item.SelectionRange},
+				depth: n.depth + 1,
+			})
+		}
+	}
+	return children, nil
+}
+
+// rows returns the visible nodes in display order. A nil node stands for the "Loading…" row of
+// the node before it.
+func (p *hierarchyPanel) rows() []*hierarchyNode {
+	var rows []*hierarchyNode
+	var walk func(nodes []*hierarchyNode)
+	walk = func(nodes []*hierarchyNode) {
+		for _, n := range nodes {
+			rows = append(rows, n)
+			if !n.expanded {
+				continue
+			}
+			if n.loading {
+				rows = append(rows, nil)
+			}
+			walk(n.children)
+		}
+	}
+	walk(p.roots)
+	return rows
+}
+
+// updateHierarchy handles clicks: toggling nodes, opening them, flipping the direction and closing.
+func (s *appState) updateHierarchy(gtx layout.Context) {
+	p := &s.hierarchy
+	if p.close.Clicked(gtx) {
+		p.visible = false
+		p.roots = nil
+		p.current = nil
+		p.gen++
+		return
+	}
+	if p.flip.Clicked(gtx) && len(p.roots) > 0 {
+		items := make([]lsp.HierarchyItem, len(p.roots))
+		for i, root := range p.roots {
+			items[i] = root.item
+		}
+		p.show(s, p.kind.opposite(), p.client, items)
+		return
+	}
+	for _, n := range p.rows() {
+		if n == nil {
+			continue
+		}
+		if n.toggle.Clicked(gtx) {
+			if n.expanded {
+				n.expanded = false
+			} else {
+				p.expand(s, n)
+			}
+		}
+		if n.click.Clicked(gtx) {
+			p.current = n
+			s.openLocation(n.loc)
+		}
+	}
+}
+
+// layoutHierarchy draws the hierarchy panel below the editor.
+func (s *appState) layoutHierarchy(gtx layout.Context) layout.Dimensions {
+	s.updateHierarchy(gtx)
+	p := &s.hierarchy
+	if !p.visible {
+		return layout.Dimensions{}
+	}
+	th := s.theme
+	height := min(gtx.Constraints.Max.Y/3, gtx.Dp(unit.Dp(260)))
+	gtx.Constraints.Min.Y, gtx.Constraints.Max.Y = height, height
+	gtx.Constraints.Min.X = gtx.Constraints.Max.X
+	paint.FillShape(gtx.Ops, th.Base.Surface, clip.Rect{Max: gtx.Constraints.Max}.Op())
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Left: unit.Dp(8), Right: unit.Dp(8), Top: unit.Dp(4), Bottom: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						title := "Type hierarchy"
+						if p.kind.calls() {
+							title = "Call hierarchy"
+						}
+						lb := material.Label(th.Material(), unit.Sp(13), title)
+						lb.Font.Weight = font.Bold
+						lb.Color = th.Base.Text
+						return lb.Layout(gtx)
+					}),
+					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+						return layout.Inset{Left: unit.Dp(10)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							summary := p.kind.String()
+							if len(p.roots) > 0 {
+								summary = fmt.Sprintf("%s of %s", summary, p.roots[0].item.Name)
+							}
+							lb := material.Label(th.Material(), unit.Sp(12), summary)
+							lb.Color = th.Base.TextSubtle
+							lb.MaxLines = 1
+							return lb.Layout(gtx)
+						})
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						return button.TextButton(th, &p.flip, "Show "+p.kind.opposite().String(), theme.KindSecondary).Layout(gtx, th)
+					}),
+					layout.Rigid(layout.Spacer{Width: unit.Dp(8)}.Layout),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						return button.TextButton(th, &p.close, "Close", theme.KindPrimary).Layout(gtx, th)
+					}),
+				)
+			})
+		}),
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			p.list.Axis = layout.Vertical
+			rows := p.rows()
+			return material.List(th.Material(), &p.list).Layout(gtx, len(rows), func(gtx layout.Context, i int) layout.Dimensions {
+				if rows[i] == nil {
+					return layoutHierarchyLoading(gtx, th, rows[i-1].depth+1)
+				}
+				return p.layoutNode(gtx, th, rows[i])
+			})
+		}),
+	)
+}
+
+// hierarchyIndent is the indentation per tree level.
+const hierarchyIndent = unit.Dp(16)
+
+func layoutHierarchyLoading(gtx layout.Context, th *theme.Theme, depth int) layout.Dimensions {
+	return layout.Inset{Left: unit.Dp(8) + hierarchyIndent*unit.Dp(depth+1), Top: unit.Dp(2), Bottom: unit.Dp(2)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		lb := material.Label(th.Material(), unit.Sp(12), "Loading…")
+		lb.Color = th.Base.TextSubtle
+		return lb.Layout(gtx)
+	})
+}
+
+// layoutNode draws a node's row: an expand chevron, the kind icon, the name and the detail.
+func (p *hierarchyPanel) layoutNode(gtx layout.Context, th *theme.Theme, n *hierarchyNode) layout.Dimensions {
+	detail := n.item.Detail
+	if path := projectPath(lsp.URIToPath(n.item.URI)); detail == "" {
+		detail = fmt.Sprintf("%s:%d", path, n.item.SelectionRange.Start.Line+1)
+	} else {
+		detail = fmt.Sprintf("%s · %s:%d", detail, path, n.item.SelectionRange.Start.Line+1)
+	}
+	if n.calls > 1 {
+		detail = fmt.Sprintf("%s · %d calls", detail, n.calls)
+	}
+	icon, iconColor := symbolKindIcon(th, n.item.Kind)
+	return layout.Background{}.Layout(gtx,
+		func(gtx layout.Context) layout.Dimensions {
+			if n == p.current || n.click.Hovered() {
+				paint.FillShape(gtx.Ops, th.Base.SurfaceHighlight, clip.Rect{Max: gtx.Constraints.Min}.Op())
+			}
+			return layout.Dimensions{Size: gtx.Constraints.Min}
+		},
+		func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min.X = gtx.Constraints.Max.X
+			return layout.Inset{Left: unit.Dp(8) + hierarchyIndent*unit.Dp(n.depth), Right: unit.Dp(8), Top: unit.Dp(2), Bottom: unit.Dp(2)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						size := gtx.Dp(hierarchyIndent)
+						if n.loaded && len(n.children) == 0 {
+							return layout.Dimensions{Size: image.Pt(size, size)}
+						}
+						return n.toggle.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							gtx.Constraints = layout.Exact(image.Pt(size, size))
+							if n.expanded {
+								return icons.ChevronDown.Layout(gtx, th.Base.TextSubtle)
+							}
+							return icons.ChevronRight.Layout(gtx, th.Base.TextSubtle)
+						})
+					}),
+					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+						return n.click.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							gtx.Constraints.Min.X = gtx.Constraints.Max.X
+							return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+								layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+									return layout.Inset{Left: unit.Dp(4), Right: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+										size := gtx.Dp(unit.Dp(14))
+										gtx.Constraints = layout.Exact(image.Pt(size, size))
+										return icon.Layout(gtx, iconColor)
+									})
+								}),
+								layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+									lb := material.Label(th.Material(), unit.Sp(12), n.item.Name)
+									lb.Color = th.Base.Text
+									lb.MaxLines = 1
+									return lb.Layout(gtx)
+								}),
+								layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+									return layout.Inset{Left: unit.Dp(10)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+										lb := material.Label(th.Material(), unit.Sp(11), detail)
+										lb.Color = th.Base.TextSubtle
+										lb.MaxLines = 1
+										return lb.Layout(gtx)
+									})
+								}),
+							)
+						})
+					}),
+				)
+			})
+		},
+	)
+}
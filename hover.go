@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"image"
+	"log"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/mirzakhany/void/lsp"
+	"go.lsp.dev/protocol"
+)
+
+// hoverGrace is how long a hover popup stays up after the pointer moves away from the hovered
+// text, giving it time to reach the popup.
+const hoverGrace = 400 * time.Millisecond
+
+// hoverCmdTag is the tag for the Ctrl+K (show hover) and Escape (hide hover) commands registered with the editor.
+var hoverCmdTag struct{}
+
+// hoverPopup holds the textDocument/hover result shown over one editor.
+type hoverPopup struct {
+	content markdownView
+	visible bool
+	// line/col of the rune the hover was requested for; the popup is anchored there.
+	line, col int
+	// seq is bumped on every request and on hide so late responses are dropped.
+	seq int
+	// hovered is true while the pointer is over the popup; leaving the editor text
+	// then doesn't close it, so links can be clicked and long docs scrolled.
+	hovered bool
+	// cancelled is when the pointer moved away from the hovered text; zero if it hasn't.
+	cancelled time.Time
+}
+
+// request asks the server for hover information at runeOff (line/col locate the popup) in the background.
+func (h *hoverPopup) request(s *appState, c *lsp.Client, docURI protocol.DocumentURI, text string, runeOff, line, col int) {
+	if !c.Supports(protocol.MethodTextDocumentHover) {
+		return
+	}
+	h.seq++
+	seq := h.seq
+	pos := lsp.RuneOffsetToPosition(text, runeOff)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		res, err := c.Hover(ctx, docURI, pos.Line, pos.Character)
+		if err != nil {
+			log.Printf("[LSP] hover failed for %q: %v", docURI, err)
+		}
+		s.runOnUI(func() {
+			if seq != h.seq {
+				return
+			}
+			h.show(res, line, col)
+		})
+	}()
+}
+
+// show displays res at line/col, or hides the popup if there is nothing to show.
+func (h *hoverPopup) show(res *protocol.Hover, line, col int) {
+	if res == nil {
+		h.hide()
+		return
+	}
+	if res.Contents.Kind == protocol.PlainText {
+		h.content.SetPlainText(res.Contents.Value)
+	} else {
+		h.content.SetText(res.Contents.Value)
+	}
+	h.line, h.col = line, col
+	h.visible = true
+	h.cancelled = time.Time{}
+}
+
+// hide closes the popup and drops any in-flight request.
+func (h *hoverPopup) hide() {
+	h.seq++
+	h.visible = false
+	h.hovered = false
+	h.cancelled = time.Time{}
+}
+
+// cancel handles the pointer moving away from the hovered text. The popup is hidden
+// after hoverGrace unless the pointer is over it by then.
+func (h *hoverPopup) cancel() {
+	if !h.visible {
+		h.seq++
+		return
+	}
+	if h.cancelled.IsZero() {
+		h.cancelled = time.Now()
+	}
+}
+
+// Layout draws the hover popup: rendered markdown in a rounded, scrollable box.
+func (h *hoverPopup) Layout(gtx layout.Context, th *theme.Theme) layout.Dimensions {
+	for {
+		ev, ok := gtx.Event(pointer.Filter{Target: h, Kinds: pointer.Enter | pointer.Leave | pointer.Cancel})
+		if !ok {
+			break
+		}
+		if e, ok := ev.(pointer.Event); ok {
+			switch e.Kind {
+			case pointer.Enter:
+				h.hovered = true
+			case pointer.Leave, pointer.Cancel:
+				h.hovered = false
+				h.hide()
+			}
+		}
+	}
+	if !h.visible {
+		return layout.Dimensions{}
+	}
+	if !h.cancelled.IsZero() && !h.hovered {
+		if deadline := h.cancelled.Add(hoverGrace); gtx.Now.Before(deadline) {
+			gtx.Execute(op.InvalidateCmd{At: deadline})
+		} else {
+			h.hide()
+			return layout.Dimensions{}
+		}
+	}
+
+	pad := unit.Dp(10)
+	gtx.Constraints.Min = image.Point{}
+	gtx.Constraints.Max.X = min(gtx.Constraints.Max.X, gtx.Dp(unit.Dp(480))+gtx.Dp(pad)*2)
+	gtx.Constraints.Max.Y = min(gtx.Constraints.Max.Y, gtx.Dp(unit.Dp(300)))
+
+	macro := op.Record(gtx.Ops)
+	dims := layout.UniformInset(pad).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return h.content.Layout(gtx, th, unit.Sp(13))
+	})
+	call := macro.Stop()
+
+	rr := clip.UniformRRect(image.Rectangle{Max: dims.Size}, gtx.Dp(unit.Dp(6)))
+	defer rr.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, h)
+	paint.Fill(gtx.Ops, th.Base.SurfaceHighlight)
+	call.Add(gtx.Ops)
+	return dims
+}
+
+// openLink opens a link clicked in rendered markdown: file URIs open in a tab and http(s) URLs
+// in the system browser. Other links are ignored; the text comes from the server or the
+// documentation it quotes, and the system handler would run whatever scheme it names.
+func (s *appState) openLink(link string) {
+	u, err := url.Parse(link)
+	if err != nil {
+		log.Printf("open link %q: %v", link, err)
+		return
+	}
+	switch u.Scheme {
+	case "file":
+		s.openFileAsTab(projectPath(lsp.URIToPath(protocol.DocumentURI(u.Scheme + "://" + u.Host + u.Path))))
+		return
+	case "http", "https":
+	default:
+		log.Printf("open link %q: unsupported scheme", link)
+		return
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", link)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", link)
+	default:
+		cmd = exec.Command("xdg-open", link)
+	}
+	if err := cmd.Start(); err != nil {
+		log.Printf("open link %q: %v", link, err)
+		return
+	}
+	go func() { _ = cmd.Wait() }()
+}
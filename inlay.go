@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"image"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/mirzakhany/void/lsp"
+	"github.com/oligo/gvcode"
+	"go.lsp.dev/protocol"
+)
+
+// inlayHintsDelay is how long inlay hints wait after an edit before they are requested again.
+const inlayHintsDelay = 300 * time.Millisecond
+
+// inlayHintsMargin is how many lines above and below the visible ones hints are requested for,
+// so scrolling a little needs no new request.
+const inlayHintsMargin = 50
+
+// inlayHintsDefaultLines is how many lines hints are requested for before the editor has been
+// laid out and the visible lines are known.
+const inlayHintsDefaultLines = 100
+
+// inlayHint is an inlay hint at a rune offset of the document.
+type inlayHint struct {
+	offset int
+	label  string
+}
+
+// inlayLine is the hints of one line, in order.
+type inlayLine struct {
+	line   int
+	labels []string
+}
+
+// inlayHints shows the server's textDocument/inlayHint results for the lines around the visible
+// ones. The editor cannot make room inside a line, so a line's hints are drawn after its end.
+// Only type hints are shown: a parameter name means nothing away from its argument.
+type inlayHints struct {
+	hints []inlayHint // sorted by offset into text
+	text  string
+	lines []inlayLine // hints grouped by line, see set
+	// first and last are the lines [first, last) hints were last requested for.
+	first, last int
+	timer       *time.Timer
+	// seq is bumped on every request so late responses are dropped.
+	seq int
+}
+
+// update keeps the hints in step with the editor: after an edit the hints move with the text and
+// are requested again once typing pauses; scrolling past the requested lines requests them for
+// the new ones. changed reports whether the text was edited this frame.
+func (h *inlayHints) update(s *appState, c *lsp.Client, docURI protocol.DocumentURI, ed *gvcode.Editor, changed bool) {
+	if !c.Supports(lsp.MethodTextDocumentInlayHint) {
+		return
+	}
+	if changed {
+		text := ed.Text()
+		h.set(shiftInlayHints(h.hints, h.text, text), text)
+		h.seq++
+		seq := h.seq
+		if h.timer != nil {
+			h.timer.Stop()
+		}
+		h.timer = time.AfterFunc(inlayHintsDelay, func() {
+			s.runOnUI(func() {
+				if seq == h.seq {
+					h.request(s, c, docURI, ed)
+				}
+			})
+		})
+		return
+	}
+	if first, last := visibleLines(ed); first < h.first || last > h.last {
+		h.request(s, c, docURI, ed)
+	}
+}
+
+// request asks the server for the hints around the visible lines in the background.
+func (h *inlayHints) request(s *appState, c *lsp.Client, docURI protocol.DocumentURI, ed *gvcode.Editor) {
+	h.seq++
+	seq := h.seq
+	text := ed.Text()
+	first, last := visibleLines(ed)
+	h.first, h.last = max(first-inlayHintsMargin, 0), last+inlayHintsMargin
+	start, _ := ed.ConvertPos(h.first, 0)
+	end, _ := ed.ConvertPos(h.last, 0)
+	rng := protocol.Range{
+		Start: lsp.RuneOffsetToPosition(text, start),
+		End:   lsp.RuneOffsetToPosition(text, end),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		result, err := c.InlayHints(ctx, docURI, rng)
+		if err != nil {
+			log.Printf("[LSP] inlayHint failed for %q: %v", docURI, err)
+			return
+		}
+		result = slices.DeleteFunc(result, func(r lsp.InlayHint) bool { return r.Kind != lsp.InlayHintKindType })
+		positions := make([]protocol.Position, len(result))
+		for i, r := range result {
+			positions[i] = r.Position
+		}
+		offsets := lsp.RuneOffsets(text, positions)
+		hints := make([]inlayHint, len(result))
+		for i, r := range result {
+			hints[i] = inlayHint{offset: offsets[i], label: strings.TrimSpace(r.Label)}
+		}
+		s.runOnUI(func() {
+			if seq != h.seq {
+				return
+			}
+			h.set(hints, text)
+		})
+	}()
+}
+
+// set replaces the hints with hints for text and groups them by line.
+func (h *inlayHints) set(hints []inlayHint, text string) {
+	slices.SortStableFunc(hints, func(a, b inlayHint) int { return a.offset - b.offset })
+	h.hints, h.text = hints, text
+	h.lines = nil
+	i, line, off := 0, 0, 0
+	for _, r := range text {
+		if i == len(hints) {
+			break
+		}
+		for i < len(hints) && hints[i].offset <= off {
+			h.addLabel(line, hints[i].label)
+			i++
+		}
+		if r == '\n' {
+			line++
+		}
+		off++
+	}
+	for ; i < len(hints); i++ {
+		h.addLabel(line, hints[i].label)
+	}
+}
+
+func (h *inlayHints) addLabel(line int, label string) {
+	if n := len(h.lines); n > 0 && h.lines[n-1].line == line {
+		h.lines[n-1].labels = append(h.lines[n-1].labels, label)
+		return
+	}
+	h.lines = append(h.lines, inlayLine{line: line, labels: []string{label}})
+}
+
+// shiftInlayHints moves hints computed for oldText to where their text is in newText. Hints inside
+// the changed text are dropped.
+func shiftInlayHints(hints []inlayHint, oldText, newText string) []inlayHint {
+	if len(hints) == 0 {
+		return nil
+	}
+	start, oldEnd, delta := changedSpan(oldText, newText)
+	shifted := make([]inlayHint, 0, len(hints))
+	for _, hint := range hints {
+		switch {
+		case hint.offset <= start:
+			shifted = append(shifted, hint)
+		case hint.offset >= oldEnd:
+			hint.offset += delta
+			shifted = append(shifted, hint)
+		}
+	}
+	return shifted
+}
+
+// Layout draws the hints of the visible lines after the end of each line, as dimmed labels the
+// editor knows nothing about.
+func (h *inlayHints) Layout(gtx layout.Context, th *theme.Theme, ed *gvcode.Editor, size image.Point) {
+	if len(h.lines) == 0 {
+		return
+	}
+	gutter := ed.GutterWidth()
+	defer clip.Rect{Min: image.Pt(gutter, 0), Max: size}.Push(gtx.Ops).Pop()
+	first, last := visibleLines(ed)
+	gap := gtx.Dp(unit.Dp(12))
+	for _, l := range h.lines {
+		if l.line < first || l.line >= last {
+			continue
+		}
+		_, end := ed.ConvertPos(l.line, math.MaxInt32)
+		pos := image.Pt(gutter+int(end.X)+gap, int(end.Y)-gtx.Sp(editorTextSize))
+		if pos.Y > size.Y {
+			continue
+		}
+		offset := op.Offset(pos).Push(gtx.Ops)
+		h.layoutLabels(gtx, th, l.labels)
+		offset.Pop()
+	}
+}
+
+func (h *inlayHints) layoutLabels(gtx layout.Context, th *theme.Theme, labels []string) layout.Dimensions {
+	gtx.Constraints.Min = image.Point{}
+	children := make([]layout.FlexChild, 0, len(labels))
+	for _, label := range labels {
+		children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Right: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Background{}.Layout(gtx,
+					func(gtx layout.Context) layout.Dimensions {
+						defer clip.UniformRRect(image.Rectangle{Max: gtx.Constraints.Min}, gtx.Dp(unit.Dp(3))).Push(gtx.Ops).Pop()
+						paint.Fill(gtx.Ops, th.Base.SurfaceHighlight)
+						return layout.Dimensions{Size: gtx.Constraints.Min}
+					},
+					func(gtx layout.Context) layout.Dimensions {
+						return layout.Inset{Left: unit.Dp(4), Right: unit.Dp(4), Top: unit.Dp(1), Bottom: unit.Dp(1)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							lb := material.Label(th.Material(), unit.Sp(12), label)
+							lb.Font = EditorFont()
+							lb.Color = th.Base.TextSubtle
+							lb.MaxLines = 1
+							return lb.Layout(gtx)
+						})
+					},
+				)
+			})
+		}))
+	}
+	return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, children...)
+}
+
+// visibleLines returns the lines [first, last) shown in the editor, estimated from its scroll
+// position. Before the editor has been laid out it returns the first inlayHintsDefaultLines.
+func visibleLines(ed *gvcode.Editor) (first, last int) {
+	n := ed.Lines()
+	_, _, minY, maxY := ed.ScrollRatio()
+	if !(maxY > minY) || math.IsInf(float64(maxY), 0) {
+		return 0, min(n, inlayHintsDefaultLines)
+	}
+	first = int(minY * float32(n))
+	last = int(math.Ceil(float64(maxY * float32(n))))
+	return max(first, 0), min(last, n)
+}
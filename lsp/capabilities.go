@@ -0,0 +1,191 @@
+package lsp
+
+import (
+	"encoding/json"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// Methods the protocol package predates (LSP 3.17).
+const (
+	MethodCodeActionResolve                = "codeAction/resolve"
+	MethodTextDocumentInlayHint            = "textDocument/inlayHint"
+	MethodWorkspaceInlayHintRefresh        = "workspace/inlayHint/refresh"
+	MethodTextDocumentPrepareTypeHierarchy = "textDocument/prepareTypeHierarchy"
+	MethodTypeHierarchySupertypes          = "typeHierarchy/supertypes"
+	MethodTypeHierarchySubtypes            = "typeHierarchy/subtypes"
+)
+
+// capabilityFor maps a request method to the server capability announcing it. If option is set,
+// the capability must be an options object with that option enabled (e.g. resolveProvider); a
+// dotted option names an option nested in another (e.g. full.delta).
+var capabilityFor = map[string]struct{ name, option string }{
+	protocol.MethodTextDocumentCompletion:           {"completionProvider", ""},
+	protocol.MethodCompletionItemResolve:            {"completionProvider", "resolveProvider"},
+	protocol.MethodTextDocumentHover:                {"hoverProvider", ""},
+	protocol.MethodTextDocumentSignatureHelp:        {"signatureHelpProvider", ""},
+	protocol.MethodTextDocumentDeclaration:          {"declarationProvider", ""},
+	protocol.MethodTextDocumentDefinition:           {"definitionProvider", ""},
+	protocol.MethodTextDocumentTypeDefinition:       {"typeDefinitionProvider", ""},
+	protocol.MethodTextDocumentImplementation:       {"implementationProvider", ""},
+	protocol.MethodTextDocumentReferences:           {"referencesProvider", ""},
+	protocol.MethodTextDocumentDocumentHighlight:    {"documentHighlightProvider", ""},
+	protocol.MethodTextDocumentDocumentSymbol:       {"documentSymbolProvider", ""},
+	protocol.MethodTextDocumentCodeAction:           {"codeActionProvider", ""},
+	MethodCodeActionResolve:                         {"codeActionProvider", "resolveProvider"},
+	protocol.MethodTextDocumentCodeLens:             {"codeLensProvider", ""},
+	protocol.MethodCodeLensResolve:                  {"codeLensProvider", "resolveProvider"},
+	protocol.MethodTextDocumentFormatting:           {"documentFormattingProvider", ""},
+	protocol.MethodTextDocumentRangeFormatting:      {"documentRangeFormattingProvider", ""},
+	protocol.MethodTextDocumentRename:               {"renameProvider", ""},
+	protocol.MethodTextDocumentPrepareRename:        {"renameProvider", "prepareProvider"},
+	protocol.MethodTextDocumentFoldingRange:         {"foldingRangeProvider", ""},
+	protocol.MethodWorkspaceSymbol:                  {"workspaceSymbolProvider", ""},
+	protocol.MethodWorkspaceExecuteCommand:          {"executeCommandProvider", ""},
+	protocol.MethodSemanticTokensFull:               {"semanticTokensProvider", "full"},
+	protocol.MethodSemanticTokensFullDelta:          {"semanticTokensProvider", "full.delta"},
+	protocol.MethodSemanticTokensRange:              {"semanticTokensProvider", "range"},
+	protocol.MethodTextDocumentPrepareCallHierarchy: {"callHierarchyProvider", ""},
+	MethodTextDocumentInlayHint:                     {"inlayHintProvider", ""},
+	MethodTextDocumentPrepareTypeHierarchy:          {"typeHierarchyProvider", ""},
+}
+
+// extraClientCapabilities are client capabilities the protocol package predates, by their dotted
+// path under "capabilities".
+var extraClientCapabilities = map[string]any{
+	"textDocument.inlayHint":     map[string]any{},
+	"textDocument.typeHierarchy": map[string]any{},
+	"workspace.inlayHint":        map[string]any{"refreshSupport": true},
+}
+
+// withExtraCapabilities encodes params with extraClientCapabilities added.
+func withExtraCapabilities(params *protocol.InitializeParams) (json.RawMessage, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for path, value := range extraClientCapabilities {
+		node := fields
+		keys := strings.Split("capabilities."+path, ".")
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := node[key].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				node[key] = child
+			}
+			node = child
+		}
+		node[keys[len(keys)-1]] = value
+	}
+	return json.Marshal(fields)
+}
+
+// setCapabilities stores the capabilities from a raw InitializeResult.
+func (c *Client) setCapabilities(initResult json.RawMessage) error {
+	var res protocol.InitializeResult
+	if err := json.Unmarshal(initResult, &res); err != nil {
+		return err
+	}
+	var raw struct {
+		Capabilities map[string]json.RawMessage `json:"capabilities"`
+	}
+	if err := json.Unmarshal(initResult, &raw); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capabilities = res.Capabilities
+	c.rawCapabilities = raw.Capabilities
+	c.syncKind = textDocumentSyncKind(res.Capabilities.TextDocumentSync)
+	return nil
+}
+
+// Capabilities returns the capabilities the server announced in its initialize result.
+func (c *Client) Capabilities() protocol.ServerCapabilities {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.capabilities
+}
+
+// Supports reports whether the server announced support for the request method
+// (e.g. protocol.MethodTextDocumentHover). Unknown methods are assumed to be supported.
+func (c *Client) Supports(method string) bool {
+	capability, ok := capabilityFor[method]
+	if !ok {
+		return true
+	}
+	c.mu.Lock()
+	value, ok := c.rawCapabilities[capability.name]
+	c.mu.Unlock()
+	if !ok || !enabled(value) {
+		return false
+	}
+	for _, option := range strings.Split(capability.option, ".") {
+		if option == "" {
+			break
+		}
+		var options map[string]json.RawMessage
+		if err := json.Unmarshal(value, &options); err != nil {
+			return false
+		}
+		if value = options[option]; !enabled(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// enabled reports whether a capability value turns the feature on: true or an options object.
+func enabled(value json.RawMessage) bool {
+	var v interface{}
+	if err := json.Unmarshal(value, &v); err != nil {
+		return false
+	}
+	switch v := v.(type) {
+	case bool:
+		return v
+	case nil:
+		return false
+	}
+	return true
+}
+
+// CompletionTriggerCharacters returns the characters that should start completion, as announced
+// in completionProvider.triggerCharacters.
+func (c *Client) CompletionTriggerCharacters() []string {
+	caps := c.Capabilities()
+	if caps.CompletionProvider == nil {
+		return nil
+	}
+	return caps.CompletionProvider.TriggerCharacters
+}
+
+// CompletionCommitCharacters returns the characters that accept the selected completion item when
+// typed, as announced in completionProvider.allCommitCharacters. Items can override them.
+func (c *Client) CompletionCommitCharacters() []string {
+	c.mu.Lock()
+	value := c.rawCapabilities["completionProvider"]
+	c.mu.Unlock()
+	var options struct {
+		AllCommitCharacters []string `json:"allCommitCharacters"`
+	}
+	if json.Unmarshal(value, &options) != nil {
+		return nil
+	}
+	return options.AllCommitCharacters
+}
+
+// SignatureHelpTriggerCharacters returns the characters that should open signature help, as
+// announced in signatureHelpProvider.triggerCharacters.
+func (c *Client) SignatureHelpTriggerCharacters() []string {
+	caps := c.Capabilities()
+	if caps.SignatureHelpProvider == nil {
+		return nil
+	}
+	return caps.SignatureHelpProvider.TriggerCharacters
+}
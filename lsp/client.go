@@ -2,6 +2,7 @@ package lsp
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"log"
 	"log/slog"
@@ -9,8 +10,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"go.lsp.dev/jsonrpc2"
 	"go.lsp.dev/protocol"
@@ -24,9 +28,19 @@ type DiagnosticsCallback func(documentURI string, diagnostics []protocol.Diagnos
 // PerDocumentDiagnosticsHandler is called with diagnostics for a single document (used when one client serves many files).
 type PerDocumentDiagnosticsHandler func(diagnostics []protocol.Diagnostic)
 
+// ApplyEditHandler applies a server-initiated workspace/applyEdit and reports whether it was applied.
+type ApplyEditHandler func(edit protocol.WorkspaceEdit) bool
+
+// RefreshHandler is called when the server asks the client to refresh what it shows of a
+// document, e.g. on workspace/inlayHint/refresh.
+type RefreshHandler func()
+
 // DecorationSource is the source tag used for LSP diagnostics in gvcode decorations.
 const DecorationSource = "lsp"
 
+// processExitTimeout is how long a server process may linger after its connection ended before it is killed.
+const processExitTimeout = 2 * time.Second
+
 // stdioConn connects Read from process stdout and Write to process stdin.
 type stdioConn struct {
 	r io.Reader
@@ -59,29 +73,75 @@ var _ io.ReadWriteCloser = (*stdioConn)(nil)
 type Client struct {
 	conn      jsonrpc2.Conn
 	server    protocol.Server
+	proc      *process // server process of the current connection
 	diagHandlers map[string]PerDocumentDiagnosticsHandler // URI -> handler
+	refreshHandlers map[string]map[string]RefreshHandler // refresh method -> URI -> handler
+	applyEdit    ApplyEditHandler
+	syncKind     protocol.TextDocumentSyncKind // how the server wants didChange (from InitializeResult)
+	capabilities    protocol.ServerCapabilities
+	rawCapabilities map[string]json.RawMessage // capability name -> value, see Supports
+	rootURI string
+	command string
+	args    []string
+	initOptions json.RawMessage // initializationOptions sent with initialize
+	docs    map[protocol.DocumentURI]*openDocument // open documents, re-opened after a restart
+	closed  bool                                   // set by Close; a closed client is not restarted
 	mu        sync.Mutex
 }
 
+// openDocument is the state of a document the client has opened, as the server last saw it.
+type openDocument struct {
+	languageID string
+	version    int32
+	text       string
+}
+
+// process is a running language server process.
+type process struct {
+	cmd    *exec.Cmd
+	conn   jsonrpc2.Conn
+	exited chan struct{} // closed once the process has exited and been reaped
+	err    error         // how the process exited; set before exited is closed
+}
+
 // NewClient starts the language server process (command + args), connects via stdio,
-// and performs LSP initialize/initialized. rootURI is the workspace root (file URI).
+// and performs LSP initialize/initialized. rootURI is the workspace root (file URI); initOptions,
+// if set, are sent as the initializationOptions.
 // Register diagnostics handlers per document with RegisterDiagnosticsHandler.
-func NewClient(ctx context.Context, rootURI string, command string, args []string) (*Client, error) {
-	cmd := exec.CommandContext(ctx, command, args...)
+func NewClient(ctx context.Context, rootURI string, command string, args []string, initOptions json.RawMessage) (*Client, error) {
+	client := &Client{
+		diagHandlers:    make(map[string]PerDocumentDiagnosticsHandler),
+		refreshHandlers: make(map[string]map[string]RefreshHandler),
+		rootURI:         rootURI,
+		command:         command,
+		args:            args,
+		initOptions:     initOptions,
+		docs:            make(map[protocol.DocumentURI]*openDocument),
+	}
+	if err := client.start(ctx); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// start launches the server process, connects via stdio and performs initialize/initialized.
+// On success the new connection replaces the current one.
+func (c *Client) start(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, c.command, c.args...)
 	cmd.Stderr = os.Stderr
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		_ = stdin.Close()
-		return nil, err
+		return err
 	}
 	if err := cmd.Start(); err != nil {
 		_ = stdin.Close()
 		_ = stdout.Close()
-		return nil, err
+		return err
 	}
 	stream := jsonrpc2.NewStream(stdioConn{
 		r: stdout,
@@ -93,30 +153,92 @@ func NewClient(ctx context.Context, rootURI string, command string, args []strin
 	if slog.Default().Enabled(ctx, slog.LevelDebug) {
 		logger = zap.NewExample()
 	}
-
-	client := &Client{
-		conn:         conn,
-		server:       protocol.ServerDispatcher(conn, logger),
-		diagHandlers: make(map[string]PerDocumentDiagnosticsHandler),
+	proc := &process{cmd: cmd, conn: conn, exited: make(chan struct{})}
+	go func() {
+		// Reap the process only once its connection has stopped reading from stdout.
+		<-conn.Done()
+		proc.err = cmd.Wait()
+		close(proc.exited)
+	}()
+	fail := func(err error) error {
+		proc.kill()
+		return err
 	}
+
 	// Pass our client so server notifications (e.g. publishDiagnostics) call our methods, not the protocol's default client.
-	handler := protocol.ClientHandler(client, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	// Handle messages off the read loop: workspace/applyEdit waits for the UI, which may itself be
+	// waiting for a response from this connection.
+	handler := protocol.ClientHandler(c, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		c.refresh(req.Method())
 		return reply(ctx, nil, nil)
 	})
-	conn.Go(ctx, handler)
+	conn.Go(ctx, jsonrpc2.AsyncHandler(handler))
 
 	initParams := &protocol.InitializeParams{
 		ProcessID: int32(os.Getpid()),
-		RootURI:   protocol.URI(rootURI),
+		RootURI:   protocol.URI(c.rootURI),
 		Capabilities: protocol.ClientCapabilities{
 			TextDocument: &protocol.TextDocumentClientCapabilities{
 				Completion: &protocol.CompletionTextDocumentClientCapabilities{
 					CompletionItem: &protocol.CompletionTextDocumentClientCapabilitiesItem{
-						SnippetSupport:       true,
-						InsertReplaceSupport: true,
-						DocumentationFormat:  []protocol.MarkupKind{protocol.Markdown, protocol.PlainText},
-						DeprecatedSupport:    true,
+						SnippetSupport:          true,
+						InsertReplaceSupport:    true,
+						CommitCharactersSupport: true,
+						DocumentationFormat:     []protocol.MarkupKind{protocol.Markdown, protocol.PlainText},
+						DeprecatedSupport:       true,
+						TagSupport: &protocol.CompletionTextDocumentClientCapabilitiesItemTagSupport{
+							ValueSet: []protocol.CompletionItemTag{protocol.CompletionItemTagDeprecated},
+						},
+						ResolveSupport: &protocol.CompletionTextDocumentClientCapabilitiesItemResolveSupport{
+							Properties: []string{"documentation", "detail"},
+						},
+					},
+				},
+				Hover: &protocol.HoverTextDocumentClientCapabilities{
+					ContentFormat: []protocol.MarkupKind{protocol.Markdown, protocol.PlainText},
+				},
+				Declaration:    &protocol.DeclarationTextDocumentClientCapabilities{LinkSupport: true},
+				Definition:     &protocol.DefinitionTextDocumentClientCapabilities{LinkSupport: true},
+				TypeDefinition: &protocol.TypeDefinitionTextDocumentClientCapabilities{LinkSupport: true},
+				Implementation: &protocol.ImplementationTextDocumentClientCapabilities{LinkSupport: true},
+				References:     &protocol.ReferencesTextDocumentClientCapabilities{},
+				Rename:         &protocol.RenameClientCapabilities{PrepareSupport: true},
+				CodeAction: &protocol.CodeActionClientCapabilities{
+					CodeActionLiteralSupport: &protocol.CodeActionClientCapabilitiesLiteralSupport{
+						CodeActionKind: &protocol.CodeActionClientCapabilitiesKind{
+							ValueSet: []protocol.CodeActionKind{
+								protocol.QuickFix, protocol.Refactor, protocol.RefactorExtract, protocol.RefactorInline,
+								protocol.RefactorRewrite, protocol.Source, protocol.SourceOrganizeImports,
+							},
+						},
+					},
+					IsPreferredSupport: true,
+					DisabledSupport:    true,
+					DataSupport:        true,
+					ResolveSupport:     &protocol.CodeActionClientCapabilitiesResolveSupport{Properties: []string{"edit"}},
+				},
+				Formatting:      &protocol.DocumentFormattingClientCapabilities{},
+				RangeFormatting: &protocol.DocumentRangeFormattingClientCapabilities{},
+				SignatureHelp: &protocol.SignatureHelpTextDocumentClientCapabilities{
+					SignatureInformation: &protocol.TextDocumentClientCapabilitiesSignatureInformation{
+						DocumentationFormat:    []protocol.MarkupKind{protocol.Markdown, protocol.PlainText},
+						ParameterInformation:   &protocol.TextDocumentClientCapabilitiesParameterInformation{LabelOffsetSupport: true},
+						ActiveParameterSupport: true,
+					},
+					ContextSupport: true,
+				},
+				SemanticTokens: &protocol.SemanticTokensClientCapabilities{
+					Requests: protocol.SemanticTokensWorkspaceClientCapabilitiesRequests{
+						Full: map[string]bool{"delta": true},
 					},
+					TokenTypes:     semanticTokenTypes,
+					TokenModifiers: semanticTokenModifiers,
+					Formats:        []protocol.TokenFormat{protocol.TokenFormatRelative},
+				},
+				CodeLens:      &protocol.CodeLensClientCapabilities{},
+				CallHierarchy: &protocol.CallHierarchyClientCapabilities{},
+				DocumentSymbol: &protocol.DocumentSymbolClientCapabilities{
+					HierarchicalDocumentSymbolSupport: true,
 				},
 				PublishDiagnostics: &protocol.PublishDiagnosticsClientCapabilities{
 					RelatedInformation: true,
@@ -124,6 +246,12 @@ func NewClient(ctx context.Context, rootURI string, command string, args []strin
 			},
 			Workspace: &protocol.WorkspaceClientCapabilities{
 				WorkspaceFolders: true,
+				ApplyEdit:        true,
+				ExecuteCommand:   &protocol.ExecuteCommandClientCapabilities{},
+				CodeLens:         &protocol.CodeLensWorkspaceClientCapabilities{RefreshSupport: true},
+				WorkspaceEdit: &protocol.WorkspaceClientCapabilitiesWorkspaceEdit{
+					DocumentChanges: true,
+				},
 			},
 		},
 		ClientInfo: &protocol.ClientInfo{
@@ -131,19 +259,110 @@ func NewClient(ctx context.Context, rootURI string, command string, args []strin
 			Version: "0.1",
 		},
 	}
-	initResult, err := client.server.Initialize(ctx, initParams)
+	if len(c.initOptions) > 0 {
+		initParams.InitializationOptions = c.initOptions
+	}
+	params, err := withExtraCapabilities(initParams)
 	if err != nil {
-		_ = conn.Close()
-		return nil, err
+		return fail(err)
+	}
+	// Keep the raw result too: capabilities newer than the protocol package (e.g. inlay hints)
+	// are only available from it.
+	var initRaw json.RawMessage
+	if _, err := conn.Call(ctx, protocol.MethodInitialize, params, &initRaw); err != nil {
+		return fail(err)
+	}
+	if err := c.setCapabilities(initRaw); err != nil {
+		return fail(err)
 	}
-	_ = initResult
 
-	if err := client.conn.Notify(ctx, protocol.MethodInitialized, &protocol.InitializedParams{}); err != nil {
-		_ = conn.Close()
-		return nil, err
+	if err := conn.Notify(ctx, protocol.MethodInitialized, &protocol.InitializedParams{}); err != nil {
+		return fail(err)
 	}
 
-	return client, nil
+	c.mu.Lock()
+	c.conn = conn
+	c.server = protocol.ServerDispatcher(conn, logger)
+	c.proc = proc
+	c.mu.Unlock()
+	return nil
+}
+
+// restart starts a new server process in place of one that exited and re-opens every open
+// document on it, so diagnostics and completion resume without the editor doing anything. Only
+// failing to start the process is an error: a document that cannot be re-opened is logged and
+// skipped, since the process is running and the caller would otherwise start another one.
+func (c *Client) restart(ctx context.Context) error {
+	if err := c.start(ctx); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	docs := make(map[protocol.DocumentURI]openDocument, len(c.docs))
+	for uri, doc := range c.docs {
+		docs[uri] = *doc
+	}
+	c.mu.Unlock()
+	for uri, doc := range docs {
+		if err := c.rpc().Notify(ctx, protocol.MethodTextDocumentDidOpen, &protocol.DidOpenTextDocumentParams{
+			TextDocument: protocol.TextDocumentItem{
+				URI:        uri,
+				LanguageID: protocol.LanguageIdentifier(doc.languageID),
+				Version:    doc.version,
+				Text:       doc.text,
+			},
+		}); err != nil {
+			log.Printf("[LSP] failed to re-open %q after restart: %v", uri, err)
+		}
+	}
+	return nil
+}
+
+// rpc returns the current connection.
+func (c *Client) rpc() jsonrpc2.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+// dispatcher returns the protocol.Server for the current connection.
+func (c *Client) dispatcher() protocol.Server {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.server
+}
+
+// done returns a channel that is closed when the current connection ends, e.g. because the
+// server process exited.
+func (c *Client) done() <-chan struct{} {
+	return c.rpc().Done()
+}
+
+// wait waits for the server process of the current connection to exit and returns how it
+// exited. The process is killed if it is still running when ctx is done.
+func (c *Client) wait(ctx context.Context) error {
+	c.mu.Lock()
+	proc := c.proc
+	c.mu.Unlock()
+	select {
+	case <-proc.exited:
+	case <-ctx.Done():
+		proc.kill()
+	}
+	return proc.err
+}
+
+// kill kills the process and waits until it has been reaped.
+func (p *process) kill() {
+	_ = p.cmd.Process.Kill()
+	_ = p.conn.Close()
+	<-p.exited
+}
+
+// isClosed reports whether Close was called.
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
 }
 
 // diagKey returns a canonical key for handler lookup so URIs from the server match our registration.
@@ -208,6 +427,45 @@ func (c *Client) UnregisterDiagnosticsHandler(documentURI string) {
 	c.RegisterDiagnosticsHandler(documentURI, nil)
 }
 
+// RegisterRefreshHandler registers fn to be called when the server sends the refresh request
+// method (e.g. MethodWorkspaceInlayHintRefresh). A nil fn removes the handler.
+func (c *Client) RegisterRefreshHandler(method string, documentURI string, fn RefreshHandler) {
+	key := diagKey(documentURI)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fn == nil {
+		delete(c.refreshHandlers[method], key)
+		return
+	}
+	if c.refreshHandlers[method] == nil {
+		c.refreshHandlers[method] = make(map[string]RefreshHandler)
+	}
+	c.refreshHandlers[method][key] = fn
+}
+
+// UnregisterRefreshHandlers removes all refresh handlers for the given document URI.
+func (c *Client) UnregisterRefreshHandlers(documentURI string) {
+	key := diagKey(documentURI)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, handlers := range c.refreshHandlers {
+		delete(handlers, key)
+	}
+}
+
+// refresh calls the handlers registered for a refresh request method.
+func (c *Client) refresh(method string) {
+	c.mu.Lock()
+	handlers := make([]RefreshHandler, 0, len(c.refreshHandlers[method]))
+	for _, fn := range c.refreshHandlers[method] {
+		handlers = append(handlers, fn)
+	}
+	c.mu.Unlock()
+	for _, fn := range handlers {
+		fn()
+	}
+}
+
 // Progress, LogMessage, ShowMessage, etc. - no-op to satisfy protocol.Client.
 func (c *Client) Progress(ctx context.Context, params *protocol.ProgressParams) error                     { return nil }
 func (c *Client) WorkDoneProgressCreate(ctx context.Context, params *protocol.WorkDoneProgressCreateParams) error { return nil }
@@ -223,9 +481,26 @@ func (c *Client) RegisterCapability(ctx context.Context, params *protocol.Regist
 func (c *Client) UnregisterCapability(ctx context.Context, params *protocol.UnregistrationParams) error {
 	return nil
 }
+
+// ApplyEdit implements protocol.Client: it hands server-initiated edits to the handler set with SetApplyEditHandler.
 func (c *Client) ApplyEdit(ctx context.Context, params *protocol.ApplyWorkspaceEditParams) (bool, error) {
-	return true, nil
+	c.mu.Lock()
+	fn := c.applyEdit
+	c.mu.Unlock()
+	if fn == nil || params == nil {
+		return false, nil
+	}
+	return fn(params.Edit), nil
 }
+
+// SetApplyEditHandler sets the handler for server-initiated workspace/applyEdit requests.
+// Without one, such edits are rejected.
+func (c *Client) SetApplyEditHandler(fn ApplyEditHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.applyEdit = fn
+}
+
 func (c *Client) WorkspaceFolders(ctx context.Context) ([]protocol.WorkspaceFolder, error) {
 	return nil, nil
 }
@@ -233,23 +508,394 @@ func (c *Client) Configuration(ctx context.Context, params *protocol.Configurati
 	return nil, nil
 }
 
-// Completion requests completion at the given position (0-based line and character).
-func (c *Client) Completion(ctx context.Context, docURI protocol.DocumentURI, line, character uint32, text string) (*protocol.CompletionList, error) {
-	params := &protocol.CompletionParams{
+// Hover requests hover information at the given position (0-based line and UTF-16 character).
+// The contents are normalized to MarkupContent, so servers that still reply with the deprecated
+// MarkedString forms are rendered the same way. Returns nil if the server has nothing to show.
+func (c *Client) Hover(ctx context.Context, docURI protocol.DocumentURI, line, character uint32) (*protocol.Hover, error) {
+	params := &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+			Position:     protocol.Position{Line: line, Character: character},
+		},
+	}
+	var raw struct {
+		Contents json.RawMessage `json:"contents"`
+		Range    *protocol.Range `json:"range,omitempty"`
+	}
+	if _, err := c.rpc().Call(ctx, protocol.MethodTextDocumentHover, params, &raw); err != nil {
+		return nil, err
+	}
+	contents := hoverContents(raw.Contents)
+	if strings.TrimSpace(contents.Value) == "" {
+		return nil, nil
+	}
+	return &protocol.Hover{Contents: contents, Range: raw.Range}, nil
+}
+
+// hoverContents converts MarkupContent | MarkedString | MarkedString[] to MarkupContent.
+func hoverContents(data json.RawMessage) protocol.MarkupContent {
+	var markup protocol.MarkupContent
+	if err := json.Unmarshal(data, &markup); err == nil && markup.Kind != "" {
+		return markup
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		list = []json.RawMessage{data}
+	}
+	parts := make([]string, 0, len(list))
+	for _, item := range list {
+		var s string
+		if err := json.Unmarshal(item, &s); err == nil {
+			parts = append(parts, s)
+			continue
+		}
+		var ms struct {
+			Language string `json:"language"`
+			Value    string `json:"value"`
+		}
+		if err := json.Unmarshal(item, &ms); err == nil && ms.Value != "" {
+			parts = append(parts, "```"+ms.Language+"\n"+ms.Value+"\n```")
+		}
+	}
+	return protocol.MarkupContent{Kind: protocol.Markdown, Value: strings.Join(parts, "\n\n")}
+}
+
+// Definition requests textDocument/definition at the given position (0-based line and UTF-16 character).
+func (c *Client) Definition(ctx context.Context, docURI protocol.DocumentURI, line, character uint32) ([]protocol.Location, error) {
+	return c.locations(ctx, protocol.MethodTextDocumentDefinition, docURI, line, character)
+}
+
+// Declaration requests textDocument/declaration at the given position.
+func (c *Client) Declaration(ctx context.Context, docURI protocol.DocumentURI, line, character uint32) ([]protocol.Location, error) {
+	return c.locations(ctx, protocol.MethodTextDocumentDeclaration, docURI, line, character)
+}
+
+// TypeDefinition requests textDocument/typeDefinition at the given position.
+func (c *Client) TypeDefinition(ctx context.Context, docURI protocol.DocumentURI, line, character uint32) ([]protocol.Location, error) {
+	return c.locations(ctx, protocol.MethodTextDocumentTypeDefinition, docURI, line, character)
+}
+
+// Implementation requests textDocument/implementation at the given position.
+func (c *Client) Implementation(ctx context.Context, docURI protocol.DocumentURI, line, character uint32) ([]protocol.Location, error) {
+	return c.locations(ctx, protocol.MethodTextDocumentImplementation, docURI, line, character)
+}
+
+// References requests textDocument/references for the symbol at the given position.
+func (c *Client) References(ctx context.Context, docURI protocol.DocumentURI, line, character uint32, includeDeclaration bool) ([]protocol.Location, error) {
+	params := &protocol.ReferenceParams{
 		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
 			TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
 			Position:     protocol.Position{Line: line, Character: character},
 		},
-		Context: &protocol.CompletionContext{
-			TriggerKind: protocol.CompletionTriggerKindInvoked,
+		Context: protocol.ReferenceContext{IncludeDeclaration: includeDeclaration},
+	}
+	return c.dispatcher().References(ctx, params)
+}
+
+// DocumentHighlights requests textDocument/documentHighlight: the occurrences in the document of
+// the symbol at the given position.
+func (c *Client) DocumentHighlights(ctx context.Context, docURI protocol.DocumentURI, line, character uint32) ([]protocol.DocumentHighlight, error) {
+	params := &protocol.DocumentHighlightParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+			Position:     protocol.Position{Line: line, Character: character},
 		},
 	}
-	return c.server.Completion(ctx, params)
+	return c.dispatcher().DocumentHighlight(ctx, params)
+}
+
+// PrepareRename sends textDocument/prepareRename. It returns the range of the symbol that would be
+// renamed and the server's suggested placeholder (empty if none). A nil range means the symbol at
+// the position cannot be renamed.
+func (c *Client) PrepareRename(ctx context.Context, docURI protocol.DocumentURI, line, character uint32) (*protocol.Range, string, error) {
+	params := &protocol.PrepareRenameParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+			Position:     protocol.Position{Line: line, Character: character},
+		},
+	}
+	var raw json.RawMessage
+	if _, err := c.rpc().Call(ctx, protocol.MethodTextDocumentPrepareRename, params, &raw); err != nil {
+		return nil, "", err
+	}
+	// Range | { range, placeholder } | { defaultBehavior } | null
+	var res struct {
+		protocol.Range
+		R               *protocol.Range `json:"range"`
+		Placeholder     string          `json:"placeholder"`
+		DefaultBehavior bool            `json:"defaultBehavior"`
+	}
+	if len(raw) == 0 || string(raw) == "null" || json.Unmarshal(raw, &res) != nil {
+		return nil, "", nil
+	}
+	switch {
+	case res.R != nil:
+		return res.R, res.Placeholder, nil
+	case res.DefaultBehavior:
+		pos := protocol.Position{Line: line, Character: character}
+		return &protocol.Range{Start: pos, End: pos}, "", nil
+	default:
+		return &res.Range, "", nil
+	}
+}
+
+// Rename sends textDocument/rename and returns the edit that renames the symbol at the position to newName.
+func (c *Client) Rename(ctx context.Context, docURI protocol.DocumentURI, line, character uint32, newName string) (*protocol.WorkspaceEdit, error) {
+	params := &protocol.RenameParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+			Position:     protocol.Position{Line: line, Character: character},
+		},
+		NewName: newName,
+	}
+	return c.dispatcher().Rename(ctx, params)
+}
+
+// Formatting requests textDocument/formatting and returns the edits that format the whole document.
+func (c *Client) Formatting(ctx context.Context, docURI protocol.DocumentURI, options protocol.FormattingOptions) ([]protocol.TextEdit, error) {
+	return c.dispatcher().Formatting(ctx, &protocol.DocumentFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+		Options:      options,
+	})
+}
+
+// RangeFormatting requests textDocument/rangeFormatting and returns the edits that format rng.
+func (c *Client) RangeFormatting(ctx context.Context, docURI protocol.DocumentURI, rng protocol.Range, options protocol.FormattingOptions) ([]protocol.TextEdit, error) {
+	return c.dispatcher().RangeFormatting(ctx, &protocol.DocumentRangeFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+		Range:        rng,
+		Options:      options,
+	})
+}
+
+// CodeActions requests textDocument/codeAction for rng with the diagnostics that overlap it.
+// only restricts the result to actions of those kinds (nil for all). Results that are bare
+// commands are returned as code actions carrying just that command.
+func (c *Client) CodeActions(ctx context.Context, docURI protocol.DocumentURI, rng protocol.Range, diagnostics []protocol.Diagnostic, only []protocol.CodeActionKind) ([]protocol.CodeAction, error) {
+	if diagnostics == nil {
+		diagnostics = []protocol.Diagnostic{}
+	}
+	params := &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+		Range:        rng,
+		Context:      protocol.CodeActionContext{Diagnostics: diagnostics, Only: only},
+	}
+	var raw []json.RawMessage
+	if _, err := c.rpc().Call(ctx, protocol.MethodTextDocumentCodeAction, params, &raw); err != nil {
+		return nil, err
+	}
+	actions := make([]protocol.CodeAction, 0, len(raw))
+	for _, item := range raw {
+		var probe struct {
+			Command json.RawMessage `json:"command"`
+		}
+		if err := json.Unmarshal(item, &probe); err != nil {
+			continue
+		}
+		// A Command has a string "command"; a CodeAction's optional command is an object.
+		if len(probe.Command) > 0 && probe.Command[0] == '"' {
+			var cmd protocol.Command
+			if err := json.Unmarshal(item, &cmd); err == nil {
+				actions = append(actions, protocol.CodeAction{Title: cmd.Title, Command: &cmd})
+			}
+			continue
+		}
+		var action protocol.CodeAction
+		if err := json.Unmarshal(item, &action); err == nil {
+			actions = append(actions, action)
+		}
+	}
+	return actions, nil
+}
+
+// ResolveCodeAction sends codeAction/resolve to fill in the edit of an action the server
+// returned without one.
+func (c *Client) ResolveCodeAction(ctx context.Context, action protocol.CodeAction) (protocol.CodeAction, error) {
+	var resolved protocol.CodeAction
+	if _, err := c.rpc().Call(ctx, MethodCodeActionResolve, &action, &resolved); err != nil {
+		return action, err
+	}
+	return resolved, nil
+}
+
+// ExecuteCommand sends workspace/executeCommand. Edits the command makes come back as
+// workspace/applyEdit requests, see SetApplyEditHandler.
+func (c *Client) ExecuteCommand(ctx context.Context, cmd protocol.Command) error {
+	_, err := c.dispatcher().ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	})
+	return err
+}
+
+// SignatureHelp is a textDocument/signatureHelp result, decoded for display.
+type SignatureHelp struct {
+	Signatures      []Signature
+	ActiveSignature int // index into Signatures
+}
+
+// Signature is one signature of a SignatureHelp.
+type Signature struct {
+	Label         string
+	Documentation protocol.MarkupContent
+	// Params are the [start, end) rune offsets of each parameter in Label.
+	Params [][2]int
+	// ActiveParam is the index of the parameter the caret is in, or -1 if there is none.
+	ActiveParam int
+}
+
+// SignatureHelp requests textDocument/signatureHelp at the given position (0-based line and UTF-16
+// character). triggerChar is the typed character that triggered the request, if any; retrigger
+// is set when signature help is already showing. Returns nil if there is no signature to show.
+func (c *Client) SignatureHelp(ctx context.Context, docURI protocol.DocumentURI, line, character uint32, triggerChar string, retrigger bool) (*SignatureHelp, error) {
+	sigCtx := &protocol.SignatureHelpContext{
+		TriggerKind: protocol.SignatureHelpTriggerKindInvoked,
+		IsRetrigger: retrigger,
+	}
+	switch {
+	case triggerChar != "":
+		sigCtx.TriggerKind = protocol.SignatureHelpTriggerKindTriggerCharacter
+		sigCtx.TriggerCharacter = triggerChar
+	case retrigger:
+		sigCtx.TriggerKind = protocol.SignatureHelpTriggerKindContentChange
+	}
+	params := &protocol.SignatureHelpParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+			Position:     protocol.Position{Line: line, Character: character},
+		},
+		Context: sigCtx,
+	}
+	// Decode by hand: parameter labels may be [start, end] offsets, which protocol.ParameterInformation
+	// can't hold, and a signature's own activeParameter must be told apart from a missing one.
+	var raw struct {
+		Signatures []struct {
+			Label         string          `json:"label"`
+			Documentation json.RawMessage `json:"documentation"`
+			Parameters    []struct {
+				Label json.RawMessage `json:"label"`
+			} `json:"parameters"`
+			ActiveParameter *int `json:"activeParameter"`
+		} `json:"signatures"`
+		ActiveSignature int `json:"activeSignature"`
+		ActiveParameter int `json:"activeParameter"`
+	}
+	if _, err := c.rpc().Call(ctx, protocol.MethodTextDocumentSignatureHelp, params, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Signatures) == 0 {
+		return nil, nil
+	}
+	help := &SignatureHelp{ActiveSignature: raw.ActiveSignature}
+	if help.ActiveSignature < 0 || help.ActiveSignature >= len(raw.Signatures) {
+		help.ActiveSignature = 0
+	}
+	for _, rs := range raw.Signatures {
+		sig := Signature{Label: rs.Label, ActiveParam: raw.ActiveParameter}
+		if rs.ActiveParameter != nil {
+			sig.ActiveParam = *rs.ActiveParameter
+		}
+		if len(rs.Documentation) > 0 {
+			sig.Documentation = markupContent(rs.Documentation)
+		}
+		from := 0 // string labels are searched for after the previous parameter
+		for _, p := range rs.Parameters {
+			start, end := parameterLabelRange(rs.Label, p.Label, from)
+			sig.Params = append(sig.Params, [2]int{start, end})
+			if end > from {
+				from = end
+			}
+		}
+		if sig.ActiveParam < 0 || sig.ActiveParam >= len(sig.Params) {
+			sig.ActiveParam = -1
+		}
+		help.Signatures = append(help.Signatures, sig)
+	}
+	return help, nil
+}
+
+// parameterLabelRange returns the rune range of a parameter in a signature label. The parameter's
+// label is either a substring of the signature label (searched for from rune offset from) or
+// [start, end] UTF-16 offsets into it. An empty range is returned if it can't be found.
+func parameterLabelRange(sigLabel string, paramLabel json.RawMessage, from int) (start, end int) {
+	var offsets [2]int
+	if err := json.Unmarshal(paramLabel, &offsets); err == nil {
+		return utf16OffsetToRune(sigLabel, offsets[0]), utf16OffsetToRune(sigLabel, offsets[1])
+	}
+	var label string
+	if err := json.Unmarshal(paramLabel, &label); err != nil || label == "" {
+		return 0, 0
+	}
+	runes := []rune(sigLabel)
+	from = min(from, len(runes))
+	i := strings.Index(string(runes[from:]), label)
+	if i < 0 {
+		return 0, 0
+	}
+	start = from + utf8.RuneCountInString(string(runes[from:])[:i])
+	return start, start + utf8.RuneCountInString(label)
+}
+
+// markupContent converts string | MarkupContent documentation to MarkupContent; a bare string is plain text.
+func markupContent(data json.RawMessage) protocol.MarkupContent {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return protocol.MarkupContent{Kind: protocol.PlainText, Value: s}
+	}
+	var markup protocol.MarkupContent
+	if err := json.Unmarshal(data, &markup); err != nil {
+		return protocol.MarkupContent{}
+	}
+	return markup
+}
+
+// locations sends a position request whose result is Location | Location[] | LocationLink[] | null.
+func (c *Client) locations(ctx context.Context, method string, docURI protocol.DocumentURI, line, character uint32) ([]protocol.Location, error) {
+	params := &protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+		Position:     protocol.Position{Line: line, Character: character},
+	}
+	var raw json.RawMessage
+	if _, err := c.rpc().Call(ctx, method, params, &raw); err != nil {
+		return nil, err
+	}
+	return decodeLocations(raw), nil
+}
+
+// decodeLocations flattens a Location | Location[] | LocationLink[] result to locations.
+// A LocationLink resolves to its target selection range (the symbol name, not the whole body).
+func decodeLocations(data json.RawMessage) []protocol.Location {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		list = []json.RawMessage{data}
+	}
+	var locs []protocol.Location
+	for _, item := range list {
+		var l struct {
+			URI                  protocol.DocumentURI `json:"uri"`
+			Range                protocol.Range       `json:"range"`
+			TargetURI            protocol.DocumentURI `json:"targetUri"`
+			TargetSelectionRange protocol.Range       `json:"targetSelectionRange"`
+		}
+		if err := json.Unmarshal(item, &l); err != nil {
+			continue
+		}
+		switch {
+		case l.TargetURI != "":
+			locs = append(locs, protocol.Location{URI: l.TargetURI, Range: l.TargetSelectionRange})
+		case l.URI != "":
+			locs = append(locs, protocol.Location{URI: l.URI, Range: l.Range})
+		}
+	}
+	return locs
 }
 
 // DidOpen sends textDocument/didOpen.
 func (c *Client) DidOpen(ctx context.Context, docURI protocol.DocumentURI, languageID string, version int32, text string) error {
-	return c.conn.Notify(ctx, protocol.MethodTextDocumentDidOpen, &protocol.DidOpenTextDocumentParams{
+	c.mu.Lock()
+	c.docs[docURI] = &openDocument{languageID: languageID, version: version, text: text}
+	c.mu.Unlock()
+	return c.rpc().Notify(ctx, protocol.MethodTextDocumentDidOpen, &protocol.DidOpenTextDocumentParams{
 		TextDocument: protocol.TextDocumentItem{
 			URI:        docURI,
 			LanguageID: protocol.LanguageIdentifier(languageID),
@@ -259,22 +905,94 @@ func (c *Client) DidOpen(ctx context.Context, docURI protocol.DocumentURI, langu
 	})
 }
 
-// DidChange sends textDocument/didChange with full document content.
-func (c *Client) DidChange(ctx context.Context, docURI protocol.DocumentURI, version int32, text string) error {
-	return c.conn.Notify(ctx, protocol.MethodTextDocumentDidChange, &protocol.DidChangeTextDocumentParams{
+// contentChange is a didChange content change. Unlike protocol.TextDocumentContentChangeEvent the
+// range is optional: a change without one replaces the whole document, while the protocol type
+// always encodes a range and so reads as an insert at 0:0.
+type contentChange struct {
+	Range *protocol.Range `json:"range,omitempty"`
+	Text  string          `json:"text"`
+}
+
+// didChangeParams is protocol.DidChangeTextDocumentParams using contentChange.
+type didChangeParams struct {
+	TextDocument   protocol.VersionedTextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []contentChange                          `json:"contentChanges"`
+}
+
+// DidChange sends textDocument/didChange for the edit that turned oldText into newText. Servers
+// that sync incrementally get the changed range only (UTF-16 positions); others get the full text.
+func (c *Client) DidChange(ctx context.Context, docURI protocol.DocumentURI, version int32, oldText, newText string) error {
+	c.mu.Lock()
+	if doc, ok := c.docs[docURI]; ok {
+		doc.version, doc.text = version, newText
+	}
+	syncKind := c.syncKind
+	c.mu.Unlock()
+	var change contentChange
+	switch syncKind {
+	case protocol.TextDocumentSyncKindNone:
+		return nil
+	case protocol.TextDocumentSyncKindIncremental:
+		change = incrementalChange(oldText, newText)
+	default:
+		change = contentChange{Text: newText}
+	}
+	return c.rpc().Notify(ctx, protocol.MethodTextDocumentDidChange, &didChangeParams{
 		TextDocument: protocol.VersionedTextDocumentIdentifier{
 			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: docURI},
 			Version:                version,
 		},
-		ContentChanges: []protocol.TextDocumentContentChangeEvent{
-			{Text: text},
-		},
+		ContentChanges: []contentChange{change},
 	})
 }
 
+// incrementalChange returns a single ranged change turning oldText into newText: the span between
+// their common prefix and common suffix.
+func incrementalChange(oldText, newText string) contentChange {
+	oldRunes, newRunes := []rune(oldText), []rune(newText)
+	prefix := 0
+	for prefix < len(oldRunes) && prefix < len(newRunes) && oldRunes[prefix] == newRunes[prefix] {
+		prefix++
+	}
+	// Don't split a CRLF line break at either end; positions can't point between \r and \n.
+	if prefix > 0 && prefix < len(oldRunes) && oldRunes[prefix-1] == '\r' && oldRunes[prefix] == '\n' {
+		prefix--
+	}
+	suffix := 0
+	for suffix < len(oldRunes)-prefix && suffix < len(newRunes)-prefix &&
+		oldRunes[len(oldRunes)-1-suffix] == newRunes[len(newRunes)-1-suffix] {
+		suffix++
+	}
+	if end := len(oldRunes) - suffix; suffix > 0 && end > 0 && oldRunes[end-1] == '\r' && oldRunes[end] == '\n' {
+		suffix--
+	}
+	return contentChange{
+		Range: &protocol.Range{
+			Start: RuneOffsetToPosition(oldText, prefix),
+			End:   RuneOffsetToPosition(oldText, len(oldRunes)-suffix),
+		},
+		Text: string(newRunes[prefix : len(newRunes)-suffix]),
+	}
+}
+
+// textDocumentSyncKind reads the didChange sync kind from the server's textDocumentSync capability
+// (TextDocumentSyncKind | TextDocumentSyncOptions). Servers that don't say get full text.
+func textDocumentSyncKind(sync interface{}) protocol.TextDocumentSyncKind {
+	switch v := sync.(type) {
+	case float64:
+		return protocol.TextDocumentSyncKind(v)
+	case map[string]interface{}:
+		if change, ok := v["change"].(float64); ok {
+			return protocol.TextDocumentSyncKind(change)
+		}
+		return protocol.TextDocumentSyncKindNone
+	}
+	return protocol.TextDocumentSyncKindFull
+}
+
 // DidSave sends textDocument/didSave so the server runs diagnostics (gopls often only runs on save).
 func (c *Client) DidSave(ctx context.Context, docURI protocol.DocumentURI, text string) error {
-	return c.conn.Notify(ctx, protocol.MethodTextDocumentDidSave, &protocol.DidSaveTextDocumentParams{
+	return c.rpc().Notify(ctx, protocol.MethodTextDocumentDidSave, &protocol.DidSaveTextDocumentParams{
 		TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
 		Text:         text,
 	})
@@ -282,14 +1000,39 @@ func (c *Client) DidSave(ctx context.Context, docURI protocol.DocumentURI, text
 
 // DidClose sends textDocument/didClose.
 func (c *Client) DidClose(ctx context.Context, docURI protocol.DocumentURI) error {
-	return c.conn.Notify(ctx, protocol.MethodTextDocumentDidClose, &protocol.DidCloseTextDocumentParams{
+	c.mu.Lock()
+	delete(c.docs, docURI)
+	c.mu.Unlock()
+	return c.rpc().Notify(ctx, protocol.MethodTextDocumentDidClose, &protocol.DidCloseTextDocumentParams{
 		TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
 	})
 }
 
-// Close closes the connection and the underlying process.
+// Shutdown stops the server gracefully: it sends the shutdown request and the exit notification
+// and waits for the process to exit. If the server doesn't answer or exit before ctx is done, the
+// process is killed. Like Close, it keeps the client from being restarted.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	server := c.dispatcher()
+	err := server.Shutdown(ctx)
+	if err == nil {
+		err = server.Exit(ctx)
+	}
+	exitErr := c.wait(ctx)
+	if err != nil {
+		return err
+	}
+	return exitErr
+}
+
+// Close closes the connection and the underlying process. A closed client is not restarted.
 func (c *Client) Close() error {
-	return c.conn.Close()
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return c.rpc().Close()
 }
 
 // FileURI returns a file:// URI for the given path.
@@ -297,6 +1040,11 @@ func FileURI(path string) protocol.DocumentURI {
 	return protocol.DocumentURI(uri.File(path))
 }
 
+// URIToPath returns the absolute file system path for a file:// URI (other URIs are returned as is).
+func URIToPath(docURI protocol.DocumentURI) string {
+	return diagKey(string(docURI))
+}
+
 // runeColToUTF16 returns the UTF-16 code unit offset for the given rune column in the line.
 func runeColToUTF16(line string, runeCol int) int {
 	runes := []rune(line)
@@ -316,9 +1064,13 @@ func runeColToUTF16(line string, runeCol int) int {
 
 // utf16OffsetToRune returns the rune index in the line for the given UTF-16 code unit offset.
 func utf16OffsetToRune(line string, utf16Offset int) int {
-	runes := []rune(line)
+	return utf16ToRuneCol([]rune(line), utf16Offset)
+}
+
+// utf16ToRuneCol is utf16OffsetToRune for a line that is already decoded.
+func utf16ToRuneCol(line []rune, utf16Offset int) int {
 	n := 0
-	for i, r := range runes {
+	for i, r := range line {
 		if n >= utf16Offset {
 			return i
 		}
@@ -328,7 +1080,7 @@ func utf16OffsetToRune(line string, utf16Offset int) int {
 			n += 2
 		}
 	}
-	return len(runes)
+	return len(line)
 }
 
 // PositionToRuneOffset converts LSP line/character (0-based, character is UTF-16) to rune offset in text.
@@ -347,6 +1099,25 @@ func PositionToRuneOffset(text string, line, character uint32) int {
 	return offset + runeCol
 }
 
+// RuneOffsets converts positions in text to rune offsets like PositionToRuneOffset, without
+// scanning text again for every position.
+func RuneOffsets(text string, positions []protocol.Position) []int {
+	lines := splitLines(text)
+	starts := make([]int, len(lines))
+	for i := 1; i < len(lines); i++ {
+		starts[i] = starts[i-1] + utf8.RuneCountInString(lines[i-1]) + 1
+	}
+	offsets := make([]int, len(positions))
+	for i, p := range positions {
+		if int(p.Line) >= len(lines) {
+			offsets[i] = utf8.RuneCountInString(text)
+			continue
+		}
+		offsets[i] = starts[p.Line] + utf16OffsetToRune(lines[p.Line], int(p.Character))
+	}
+	return offsets
+}
+
 func splitLines(s string) []string {
 	var lines []string
 	start := 0
@@ -360,6 +1131,59 @@ func splitLines(s string) []string {
 	return lines
 }
 
+// RuneOffsetToPosition converts a rune offset in text to an LSP position (0-based line, UTF-16 character).
+func RuneOffsetToPosition(text string, runeOffset int) protocol.Position {
+	lines := splitLines(text)
+	line := 0
+	for line < len(lines)-1 {
+		n := len([]rune(lines[line]))
+		if runeOffset <= n {
+			break
+		}
+		runeOffset -= n + 1 // +1 for newline
+		line++
+	}
+	return protocol.Position{
+		Line:      uint32(line),
+		Character: uint32(runeColToUTF16(lines[line], max(runeOffset, 0))),
+	}
+}
+
+// ApplyTextEdits returns text with edits applied. Edit ranges refer to the original text and must
+// not overlap, as the protocol requires.
+func ApplyTextEdits(text string, edits []protocol.TextEdit) string {
+	spans := TextEditSpans(text, edits)
+	runes := []rune(text)
+	for i := len(spans) - 1; i >= 0; i-- {
+		sp := spans[i]
+		runes = append(runes[:sp.Start:sp.Start], append([]rune(sp.NewText), runes[sp.End:]...)...)
+	}
+	return string(runes)
+}
+
+// TextEditSpan is a text edit with its range converted to rune offsets.
+type TextEditSpan struct {
+	Start, End int
+	NewText    string
+}
+
+// TextEditSpans converts edits on text to rune offset spans, sorted by start and then end.
+// Applied back to front, offsets of the spans not yet applied stay valid, inserts at the same
+// position end up in the order they were given, and an insert ends up before a replacement that
+// starts at the same position.
+func TextEditSpans(text string, edits []protocol.TextEdit) []TextEditSpan {
+	spans := make([]TextEditSpan, len(edits))
+	for i, e := range edits {
+		start, end := RangeToRuneOffsets(text, e.Range)
+		spans[i] = TextEditSpan{start, end, e.NewText}
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		a, b := spans[i], spans[j]
+		return a.Start < b.Start || a.Start == b.Start && a.End < b.End
+	})
+	return spans
+}
+
 // RangeToRuneOffsets returns start and end rune offsets for the LSP range in text.
 func RangeToRuneOffsets(text string, r protocol.Range) (start, end int) {
 	start = PositionToRuneOffset(text, r.Start.Line, r.Start.Character)
@@ -0,0 +1,107 @@
+package lsp
+
+import (
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestApplyTextEdits(t *testing.T) {
+	edit := func(startLine, startChar, endLine, endChar uint32, newText string) protocol.TextEdit {
+		return protocol.TextEdit{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: startLine, Character: startChar},
+				End:   protocol.Position{Line: endLine, Character: endChar},
+			},
+			NewText: newText,
+		}
+	}
+	tests := []struct {
+		name  string
+		text  string
+		edits []protocol.TextEdit
+		want  string
+	}{
+		{"no edits", "abc", nil, "abc"},
+		{"insert", "ac", []protocol.TextEdit{edit(0, 1, 0, 1, "b")}, "abc"},
+		{"same-position inserts", "ad", []protocol.TextEdit{edit(0, 1, 0, 1, "b"), edit(0, 1, 0, 1, "c")}, "abcd"},
+		{
+			name:  "insert before a replace at the same start",
+			text:  "hello world",
+			edits: []protocol.TextEdit{edit(0, 6, 0, 11, "there"), edit(0, 6, 0, 6, "big ")},
+			want:  "hello big there",
+		},
+		{
+			name:  "replace after an insert at the same start",
+			text:  "hello world",
+			edits: []protocol.TextEdit{edit(0, 6, 0, 6, "big "), edit(0, 6, 0, 11, "there")},
+			want:  "hello big there",
+		},
+		{
+			name:  "insert at the end of a replace",
+			text:  "abc",
+			edits: []protocol.TextEdit{edit(0, 3, 0, 3, "!"), edit(0, 0, 0, 3, "xyz")},
+			want:  "xyz!",
+		},
+		{
+			name:  "unsorted edits",
+			text:  "one\ntwo\nthree\n",
+			edits: []protocol.TextEdit{edit(2, 0, 2, 5, "3"), edit(0, 0, 0, 3, "1"), edit(1, 0, 1, 3, "2")},
+			want:  "1\n2\n3\n",
+		},
+		{"multi-line range", "one\ntwo\nthree\n", []protocol.TextEdit{edit(0, 1, 2, 2, "X")}, "oXree\n"},
+		{"join lines", "a\nb", []protocol.TextEdit{edit(0, 1, 1, 0, "")}, "ab"},
+		{
+			// Characters are UTF-16 code units: "é" is one, "𝒳" two.
+			name:  "non-ASCII",
+			text:  "héllo 𝒳y\nü",
+			edits: []protocol.TextEdit{edit(0, 6, 0, 8, "Z"), edit(0, 1, 0, 2, "e"), edit(1, 0, 1, 1, "u")},
+			want:  "hello Zy\nu",
+		},
+		{"non-ASCII multi-line", "𝒳a\nbé\nc", []protocol.TextEdit{edit(0, 2, 1, 1, "")}, "𝒳é\nc"},
+	}
+	for _, tt := range tests {
+		if got := ApplyTextEdits(tt.text, tt.edits); got != tt.want {
+			t.Errorf("%s: got %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIncrementalChange(t *testing.T) {
+	tests := []struct {
+		name             string
+		oldText, newText string
+		start, end       protocol.Position
+		text             string
+	}{
+		{"no change", "abc", "abc", protocol.Position{Line: 0, Character: 3}, protocol.Position{Line: 0, Character: 3}, ""},
+		{"both empty", "", "", protocol.Position{}, protocol.Position{}, ""},
+		{"insert at start", "bc", "abc", protocol.Position{}, protocol.Position{}, "a"},
+		{"insert in middle", "ac", "abc", protocol.Position{Line: 0, Character: 1}, protocol.Position{Line: 0, Character: 1}, "b"},
+		{"insert at end", "ab", "abc", protocol.Position{Line: 0, Character: 2}, protocol.Position{Line: 0, Character: 2}, "c"},
+		{"delete at start", "abc", "bc", protocol.Position{}, protocol.Position{Line: 0, Character: 1}, ""},
+		{"delete in middle", "abc", "ac", protocol.Position{Line: 0, Character: 1}, protocol.Position{Line: 0, Character: 2}, ""},
+		{"delete at end", "abc", "ab", protocol.Position{Line: 0, Character: 2}, protocol.Position{Line: 0, Character: 3}, ""},
+		{"repeated runes", "aaa", "aa", protocol.Position{Line: 0, Character: 2}, protocol.Position{Line: 0, Character: 3}, ""},
+		{"insert line", "a\nb", "a\nx\nb", protocol.Position{Line: 1, Character: 0}, protocol.Position{Line: 1, Character: 0}, "x\n"},
+		{"insert CRLF line", "a\r\nb", "a\r\nx\r\nb", protocol.Position{Line: 1, Character: 0}, protocol.Position{Line: 1, Character: 0}, "x\r\n"},
+		{"replace LF of CRLF", "a\r\nb", "a\r b", protocol.Position{Line: 0, Character: 1}, protocol.Position{Line: 1, Character: 0}, "\r "},
+		{"CRLF to LF", "a\r\nb", "a\nb", protocol.Position{Line: 0, Character: 1}, protocol.Position{Line: 1, Character: 0}, "\n"},
+		{"CRLF to LF at end", "x\r\n", "x\n", protocol.Position{Line: 0, Character: 1}, protocol.Position{Line: 1, Character: 0}, "\n"},
+		// "𝒳" is one rune but two UTF-16 code units.
+		{"after surrogate pair", "𝒳a𝒳", "𝒳b𝒳", protocol.Position{Line: 0, Character: 2}, protocol.Position{Line: 0, Character: 3}, "b"},
+		{"between surrogate pairs", "𝒳\n𝒳𝒳", "𝒳\n𝒳x𝒳", protocol.Position{Line: 1, Character: 2}, protocol.Position{Line: 1, Character: 2}, "x"},
+		{"replace surrogate pair", "a𝒳b", "a𝒴b", protocol.Position{Line: 0, Character: 1}, protocol.Position{Line: 0, Character: 3}, "𝒴"},
+	}
+	for _, tt := range tests {
+		got := incrementalChange(tt.oldText, tt.newText)
+		if got.Range == nil || got.Range.Start != tt.start || got.Range.End != tt.end || got.Text != tt.text {
+			t.Errorf("%s: got %+v %q; want %v-%v %q", tt.name, got.Range, got.Text, tt.start, tt.end, tt.text)
+			continue
+		}
+		edit := protocol.TextEdit{Range: *got.Range, NewText: got.Text}
+		if applied := ApplyTextEdits(tt.oldText, []protocol.TextEdit{edit}); applied != tt.newText {
+			t.Errorf("%s: applying the change gives %q; want %q", tt.name, applied, tt.newText)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package lsp
+
+import (
+	"context"
+
+	"go.lsp.dev/protocol"
+)
+
+// CodeLenses requests textDocument/codeLens for the document. Lenses may come without a command;
+// ResolveCodeLens fills it in.
+func (c *Client) CodeLenses(ctx context.Context, docURI protocol.DocumentURI) ([]protocol.CodeLens, error) {
+	return c.dispatcher().CodeLens(ctx, &protocol.CodeLensParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+	})
+}
+
+// ResolveCodeLens sends codeLens/resolve to fill in the command of a lens the server returned
+// without one.
+func (c *Client) ResolveCodeLens(ctx context.Context, lens protocol.CodeLens) (protocol.CodeLens, error) {
+	resolved, err := c.dispatcher().CodeLensResolve(ctx, &lens)
+	if err != nil {
+		return lens, err
+	}
+	if resolved == nil {
+		return lens, nil
+	}
+	return *resolved, nil
+}
@@ -0,0 +1,127 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"go.lsp.dev/protocol"
+)
+
+// CompletionList is a textDocument/completion result.
+type CompletionList struct {
+	IsIncomplete bool
+	Items        []CompletionItem
+}
+
+// CompletionItem is a completion item whose edit may have come as an InsertReplaceEdit, which the
+// protocol package cannot decode: then TextEdit.Range is the insert range and Replace the range
+// to replace instead, e.g. the whole word around the caret. Resolved reports whether
+// completionItem/resolve filled in the item's documentation; ResolveFailed, that it failed and
+// should not be retried.
+type CompletionItem struct {
+	protocol.CompletionItem
+	Replace       *protocol.Range
+	Resolved      bool
+	ResolveFailed bool
+	// raw is the item as the server sent it, which is what completionItem/resolve takes.
+	raw json.RawMessage
+}
+
+// Docs returns the item's documentation, which may come as a plain string or as MarkupContent.
+func (item CompletionItem) Docs() protocol.MarkupContent {
+	switch doc := item.Documentation.(type) {
+	case string:
+		return protocol.MarkupContent{Kind: protocol.PlainText, Value: doc}
+	case map[string]interface{}:
+		kind, _ := doc["kind"].(string)
+		value, _ := doc["value"].(string)
+		return protocol.MarkupContent{Kind: protocol.MarkupKind(kind), Value: value}
+	}
+	return protocol.MarkupContent{Kind: protocol.PlainText}
+}
+
+// IsDeprecated reports whether the item is marked deprecated, by the deprecated property or the
+// Deprecated tag.
+func (item CompletionItem) IsDeprecated() bool {
+	return item.Deprecated || slices.Contains(item.Tags, protocol.CompletionItemTagDeprecated)
+}
+
+// Completion requests completion at the given position (0-based line and character).
+func (c *Client) Completion(ctx context.Context, docURI protocol.DocumentURI, line, character uint32, text string) (*CompletionList, error) {
+	params := &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+			Position:     protocol.Position{Line: line, Character: character},
+		},
+		Context: &protocol.CompletionContext{
+			TriggerKind: protocol.CompletionTriggerKindInvoked,
+		},
+	}
+	var raw json.RawMessage
+	if _, err := c.rpc().Call(ctx, protocol.MethodTextDocumentCompletion, params, &raw); err != nil {
+		return nil, err
+	}
+	return decodeCompletionList(raw)
+}
+
+// decodeCompletionList decodes a textDocument/completion result: CompletionItem[],
+// CompletionList or null.
+func decodeCompletionList(data json.RawMessage) (*CompletionList, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var list struct {
+		IsIncomplete bool              `json:"isIncomplete"`
+		Items        []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(data, &list.Items); err != nil {
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+	}
+	result := &CompletionList{IsIncomplete: list.IsIncomplete, Items: make([]CompletionItem, 0, len(list.Items))}
+	for _, raw := range list.Items {
+		item := CompletionItem{raw: raw}
+		if err := json.Unmarshal(raw, &item.CompletionItem); err != nil {
+			continue
+		}
+		var edit struct {
+			TextEdit *struct {
+				Insert  *protocol.Range `json:"insert"`
+				Replace *protocol.Range `json:"replace"`
+			} `json:"textEdit"`
+		}
+		if json.Unmarshal(raw, &edit) == nil && edit.TextEdit != nil && edit.TextEdit.Insert != nil {
+			item.TextEdit.Range = *edit.TextEdit.Insert
+			item.Replace = edit.TextEdit.Replace
+		}
+		result.Items = append(result.Items, item)
+	}
+	return result, nil
+}
+
+// ResolveCompletionItem sends completionItem/resolve for item and returns it with the detail and
+// documentation the server filled in. Servers may also add the additional edits then; the
+// item's own edit is kept, as the protocol does not allow changing it.
+func (c *Client) ResolveCompletionItem(ctx context.Context, item CompletionItem) (CompletionItem, error) {
+	var params interface{} = item.CompletionItem
+	if item.raw != nil {
+		params = item.raw
+	}
+	var resolved protocol.CompletionItem
+	if _, err := c.rpc().Call(ctx, protocol.MethodCompletionItemResolve, params, &resolved); err != nil {
+		return item, err
+	}
+	if resolved.Detail != "" {
+		item.Detail = resolved.Detail
+	}
+	if resolved.Documentation != nil {
+		item.Documentation = resolved.Documentation
+	}
+	if len(item.AdditionalTextEdits) == 0 {
+		item.AdditionalTextEdits = resolved.AdditionalTextEdits
+	}
+	item.Resolved = true
+	return item, nil
+}
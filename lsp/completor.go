@@ -3,6 +3,8 @@ package lsp
 import (
 	"context"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"gioui.org/io/key"
 	"github.com/oligo/gvcode"
@@ -11,16 +13,32 @@ import (
 
 // Completor adapts an LSP client to gvcode.Completor for one file.
 type Completor struct {
-	Client     *Client
-	DocURI     protocol.DocumentURI
-	Editor     *gvcode.Editor
+	Client      *Client
+	DocURI      protocol.DocumentURI
+	Editor      *gvcode.Editor
 	ProjectRoot string
+	// Ranker filters and orders the candidates; one is made if it is nil.
+	Ranker *CompletionRanker
+
+	// text and caret are the document and the caret's rune offset when completion was last
+	// requested; items are the items the server returned then, in the order of the candidates.
+	text  string
+	caret int
+	items []CompletionItem
+	// shown are the indices into items of the candidates FilterAndRank returned last, which are
+	// the ones the popup lists.
+	shown []int
 }
 
-// Trigger implements gvcode.Completor: trigger on "." and on Ctrl+Space.
+// Trigger implements gvcode.Completor: trigger on the server's completion trigger characters
+// (e.g. "." for gopls) and on Ctrl+Space.
 func (c *Completor) Trigger() gvcode.Trigger {
+	var chars []string
+	if c.Client != nil {
+		chars = c.Client.CompletionTriggerCharacters()
+	}
 	return gvcode.Trigger{
-		Characters: []string{".", ":"},
+		Characters: chars,
 		KeyBinding: struct {
 			Name      key.Name
 			Modifiers key.Modifiers
@@ -32,10 +50,14 @@ func (c *Completor) Trigger() gvcode.Trigger {
 
 // Suggest implements gvcode.Completor by calling LSP textDocument/completion.
 func (c *Completor) Suggest(ctx gvcode.CompletionContext) []gvcode.CompletionCandidate {
+	c.items, c.shown = nil, nil
 	if c.Client == nil {
 		return nil
 	}
 	text := c.Editor.Text()
+	// Record where the request was made even if it fails: FilterAndRank extends the edit
+	// ranges of candidates added by other completors from there.
+	c.text, c.caret = text, ctx.Position.Runes
 	// gvcode CaretPos() is 0-based line and column (rune-based). LSP expects UTF-16 character offset.
 	line := uint32(ctx.Position.Line)
 	lineText := getLineAt(text, int(line))
@@ -48,50 +70,134 @@ func (c *Completor) Suggest(ctx gvcode.CompletionContext) []gvcode.CompletionCan
 	if list.Items == nil {
 		return nil
 	}
+	c.items = list.Items
 	candidates := make([]gvcode.CompletionCandidate, 0, len(list.Items))
 	for _, item := range list.Items {
-		cand := completionItemToCandidate(item, ctx.Position.Runes)
+		cand := completionItemToCandidate(item, text, ctx.Position)
 		candidates = append(candidates, cand)
 	}
 	return candidates
 }
 
-// FilterAndRank implements gvcode.Completor: simple prefix filter.
+// FilterAndRank implements gvcode.Completor: candidates are fuzzy-matched by their items'
+// filter text and ordered by score and sort text, see CompletionRanker. The edit ranges that end
+// at or after the caret completion was requested at are extended over what was typed since.
 func (c *Completor) FilterAndRank(pattern string, candidates []gvcode.CompletionCandidate) []gvcode.CompletionCandidate {
-	if pattern == "" {
-		return candidates
+	if c.Ranker == nil {
+		c.Ranker = &CompletionRanker{}
 	}
+	keys := make([]RankKey, len(candidates))
+	for i, cand := range candidates {
+		keys[i] = RankKey{Label: cand.Label}
+		if i < len(c.items) {
+			keys[i].Filter, keys[i].Sort = c.items[i].FilterText, c.items[i].SortText
+		}
+	}
+	c.shown = c.shown[:0]
+	line, col := c.Editor.CaretPos()
+	caret, _ := c.Editor.ConvertPos(line, col)
+	typed := max(caret-c.caret, 0)
 	filtered := make([]gvcode.CompletionCandidate, 0)
-	lower := strings.ToLower(pattern)
-	for _, cand := range candidates {
-		if strings.HasPrefix(strings.ToLower(cand.Label), lower) {
-			filtered = append(filtered, cand)
+	for _, i := range c.Ranker.Rank(pattern, keys) {
+		cand := candidates[i]
+		if end := &cand.TextEdit.EditRange.End; end.Runes >= c.caret {
+			end.Runes += typed
+			end.Column += typed
 		}
+		filtered = append(filtered, cand)
+		c.shown = append(c.shown, i)
 	}
 	return filtered
 }
 
-func completionItemToCandidate(item protocol.CompletionItem, caretRunes int) gvcode.CompletionCandidate {
+// shownItem returns the item of the idx-th candidate FilterAndRank returned last.
+func (c *Completor) shownItem(idx int) (CompletionItem, bool) {
+	if item := c.Item(idx); item != nil {
+		return *item, true
+	}
+	return CompletionItem{}, false
+}
+
+// Item returns the item of the idx-th candidate FilterAndRank returned last, or nil. The pointer
+// stays the same until completion is requested again, so updating the item through it (e.g. once
+// resolved) is seen by the other methods.
+func (c *Completor) Item(idx int) *CompletionItem {
+	if idx < 0 || idx >= len(c.shown) || c.shown[idx] >= len(c.items) {
+		return nil
+	}
+	return &c.items[c.shown[idx]]
+}
+
+// CommitCharacters returns the characters that accept the idx-th candidate FilterAndRank
+// returned last when typed while it is selected.
+func (c *Completor) CommitCharacters(idx int) []string {
+	item, ok := c.shownItem(idx)
+	if !ok {
+		return nil
+	}
+	if item.CommitCharacters != nil {
+		return item.CommitCharacters
+	}
+	return c.Client.CompletionCommitCharacters()
+}
+
+// AdditionalEdits returns the AdditionalTextEdits (e.g. an added import) of the idx-th candidate
+// FilterAndRank returned last, with their ranges moved to the editor's current text. It is
+// meant to be called right after the candidate was inserted: the edits do not overlap the
+// completed text, so the edits after the caret move by how much the text grew since the
+// request and the others stay where they are.
+func (c *Completor) AdditionalEdits(idx int) []protocol.TextEdit {
+	item, ok := c.shownItem(idx)
+	if !ok || len(item.AdditionalTextEdits) == 0 {
+		return nil
+	}
+	text := c.Editor.Text()
+	delta := utf8.RuneCountInString(text) - utf8.RuneCountInString(c.text)
+	edits := make([]protocol.TextEdit, 0, len(item.AdditionalTextEdits))
+	for _, e := range item.AdditionalTextEdits {
+		start, end := RangeToRuneOffsets(c.text, e.Range)
+		if start >= c.caret {
+			start, end = start+delta, end+delta
+		}
+		edits = append(edits, protocol.TextEdit{
+			Range: protocol.Range{
+				Start: RuneOffsetToPosition(text, start),
+				End:   RuneOffsetToPosition(text, end),
+			},
+			NewText: e.NewText,
+		})
+	}
+	return edits
+}
+
+// completionItemToCandidate converts an item returned for a request at caret in text. The item's
+// edit range (the replace range of an InsertReplaceEdit) is kept; items without an edit replace
+// the part of the word before the caret.
+func completionItemToCandidate(item CompletionItem, text string, caret gvcode.Position) gvcode.CompletionCandidate {
 	label := item.Label
 	insertText := label
 	if item.InsertText != "" {
 		insertText = item.InsertText
 	}
+	start, end := caret, caret
 	if item.TextEdit != nil {
 		insertText = item.TextEdit.NewText
-	}
-	start, end := caretRunes, caretRunes
-	if item.TextEdit != nil && item.TextEdit.Range.Start.Character != item.TextEdit.Range.End.Character {
-		// Use edit range if provided (we'd need document text to convert; for now use caret)
-		start = caretRunes
-		end = caretRunes
+		rng := item.TextEdit.Range
+		if item.Replace != nil {
+			rng = *item.Replace
+		}
+		start, end = editPosition(text, rng.Start), editPosition(text, rng.End)
+	} else {
+		lineText := []rune(getLineAt(text, caret.Line))
+		for start.Column > 0 && start.Column <= len(lineText) && isWordRune(lineText[start.Column-1]) {
+			start.Column--
+			start.Runes--
+		}
 	}
 	kind := lspKindToString(item.Kind)
 	desc := item.Detail
-	if desc == "" && item.Documentation != nil {
-		if s, ok := item.Documentation.(string); ok {
-			desc = s
-		}
+	if doc := item.Docs(); desc == "" && doc.Kind == protocol.PlainText {
+		desc, _, _ = strings.Cut(strings.TrimSpace(doc.Value), "\n")
 	}
 	textFormat := "PlainText"
 	if item.InsertTextFormat == protocol.InsertTextFormatSnippet {
@@ -100,11 +206,8 @@ func completionItemToCandidate(item protocol.CompletionItem, caretRunes int) gvc
 	return gvcode.CompletionCandidate{
 		Label: label,
 		TextEdit: gvcode.TextEdit{
-			NewText: insertText,
-			EditRange: gvcode.EditRange{
-				Start: gvcode.Position{Runes: start},
-				End:   gvcode.Position{Runes: end},
-			},
+			NewText:   insertText,
+			EditRange: gvcode.EditRange{Start: start, End: end},
 		},
 		Description: desc,
 		Kind:        kind,
@@ -112,6 +215,21 @@ func completionItemToCandidate(item protocol.CompletionItem, caretRunes int) gvc
 	}
 }
 
+// editPosition converts an LSP position in text to an editor position with both the line and
+// column and the rune offset set.
+func editPosition(text string, p protocol.Position) gvcode.Position {
+	return gvcode.Position{
+		Line:   int(p.Line),
+		Column: utf16OffsetToRune(getLineAt(text, int(p.Line)), int(p.Character)),
+		Runes:  PositionToRuneOffset(text, p.Line, p.Character),
+	}
+}
+
+// isWordRune reports whether r can be part of an identifier.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
 // getLineAt returns the line at 0-based index (without trailing newline).
 func getLineAt(text string, lineIndex int) string {
 	start := 0
@@ -17,6 +17,14 @@ type ServerEntry struct {
 	Command string `json:"command"`
 	// Args are optional arguments passed to the command.
 	Args []string `json:"args,omitempty"`
+	// InitializationOptions are sent to the server with the initialize request; what they mean
+	// is up to the server (gopls takes its settings here, e.g. whether to send semantic tokens).
+	InitializationOptions json.RawMessage `json:"initializationOptions,omitempty"`
+	// FormatOnSave formats files of this language before they are saved.
+	FormatOnSave bool `json:"formatOnSave,omitempty"`
+	// OrganizeImportsOnSave runs the server's source.organizeImports code action before files of
+	// this language are saved.
+	OrganizeImportsOnSave bool `json:"organizeImportsOnSave,omitempty"`
 }
 
 // Config holds the LSP server configuration (loadable from JSON without recompiling).
@@ -53,7 +61,7 @@ func LoadConfig(projectRoot string) *Config {
 func DefaultConfig() *Config {
 	return &Config{
 		Servers: []ServerEntry{
-			{LanguageID: "go", Extensions: []string{".go"}, Command: "gopls", Args: []string{}},
+			{LanguageID: "go", Extensions: []string{".go"}, Command: "gopls", Args: []string{}, InitializationOptions: json.RawMessage(`{"semanticTokens": true}`)},
 		},
 	}
 }
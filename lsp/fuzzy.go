@@ -0,0 +1,154 @@
+package lsp
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// FuzzyMatch reports how well pattern matches s: every rune of pattern must appear in s in
+// order, ignoring case. Matches at the start of s or of a word in it (after '_', '.', '/', or
+// at a lower-to-upper case change) and runs of consecutive matches score higher. It returns the
+// score and the rune indices of s that matched, or -1 and nil if pattern does not match.
+func FuzzyMatch(pattern, s string) (int, []int) {
+	p := []rune(strings.ToLower(pattern))
+	if len(p) == 0 {
+		return 0, nil
+	}
+	matched := make([]int, 0, len(p))
+	score, prevMatch := 0, -2
+	var prev rune
+	for j, r := range []rune(s) {
+		if len(matched) < len(p) && unicode.ToLower(r) == p[len(matched)] {
+			score++
+			switch {
+			case j == 0:
+				score += 3
+			case prev == '_' || prev == '.' || prev == '/' || unicode.IsLower(prev) && unicode.IsUpper(r):
+				score += 2
+			}
+			if prevMatch == j-1 {
+				score += 2
+			}
+			prevMatch = j
+			matched = append(matched, j)
+		}
+		prev = r
+	}
+	if len(matched) < len(p) {
+		return -1, nil
+	}
+	return score, matched
+}
+
+// maxCompletionHistory is how many accepted completions a CompletionHistory remembers.
+const maxCompletionHistory = 50
+
+// recentCompletionBoost is added to the score of a recently accepted completion.
+const recentCompletionBoost = 3
+
+// CompletionHistory remembers the labels of the completions accepted last, most recent first.
+// It is shared by the editors so that what was picked in one file ranks higher in the others.
+type CompletionHistory struct {
+	labels []string
+}
+
+// Add records that the completion with the given label was accepted.
+func (h *CompletionHistory) Add(label string) {
+	h.labels = slices.DeleteFunc(h.labels, func(l string) bool { return l == label })
+	h.labels = slices.Insert(h.labels, 0, label)
+	if len(h.labels) > maxCompletionHistory {
+		h.labels = h.labels[:maxCompletionHistory]
+	}
+}
+
+func (h *CompletionHistory) contains(label string) bool {
+	return h != nil && slices.Contains(h.labels, label)
+}
+
+// RankKey is what a completion candidate is matched and ordered by.
+type RankKey struct {
+	Label string
+	// Filter is matched against the pattern instead of the label if set (LSP filterText).
+	Filter string
+	// Sort orders candidates that score the same instead of the label if set (LSP sortText).
+	Sort string
+}
+
+// CompletionRanker filters and orders the candidates of a completion session by how well they
+// fuzzy-match what was typed, and remembers where the listed labels matched so the popup can
+// highlight it. The zero value is ready to use.
+type CompletionRanker struct {
+	History *CompletionHistory // may be nil
+
+	// labels and matches are the labels Rank listed last, in order, and the rune indices of
+	// each label that matched the pattern.
+	labels  []string
+	matches [][]int
+}
+
+// Rank returns the indices of the keys that match pattern, best first: by score, including a
+// boost for recently accepted labels, then by sort text and label.
+func (r *CompletionRanker) Rank(pattern string, keys []RankKey) []int {
+	type ranked struct {
+		idx, score int
+		matches    []int
+	}
+	list := make([]ranked, 0, len(keys))
+	for i, k := range keys {
+		filter := k.Filter
+		if filter == "" {
+			filter = k.Label
+		}
+		score, matches := FuzzyMatch(pattern, filter)
+		if score < 0 {
+			continue
+		}
+		if filter != k.Label {
+			_, matches = FuzzyMatch(pattern, k.Label)
+		}
+		if r.History.contains(k.Label) {
+			score += recentCompletionBoost
+		}
+		list = append(list, ranked{i, score, matches})
+	}
+	sortKey := func(k RankKey) string {
+		if k.Sort != "" {
+			return k.Sort
+		}
+		return k.Label
+	}
+	slices.SortStableFunc(list, func(a, b ranked) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+		if c := strings.Compare(sortKey(keys[a.idx]), sortKey(keys[b.idx])); c != 0 {
+			return c
+		}
+		return strings.Compare(keys[a.idx].Label, keys[b.idx].Label)
+	})
+	order := make([]int, len(list))
+	r.labels, r.matches = r.labels[:0], r.matches[:0]
+	for i, l := range list {
+		order[i] = l.idx
+		r.labels = append(r.labels, keys[l.idx].Label)
+		r.matches = append(r.matches, l.matches)
+	}
+	return order
+}
+
+// Matches returns the rune indices of the idx-th label Rank listed last that matched the
+// pattern.
+func (r *CompletionRanker) Matches(idx int) []int {
+	if idx < 0 || idx >= len(r.matches) {
+		return nil
+	}
+	return r.matches[idx]
+}
+
+// Accept records that the idx-th candidate Rank listed last was accepted.
+func (r *CompletionRanker) Accept(idx int) {
+	if r.History != nil && idx >= 0 && idx < len(r.labels) {
+		r.History.Add(r.labels[idx])
+	}
+}
@@ -0,0 +1,124 @@
+package lsp
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		score      int
+		matched    []int
+	}{
+		{"", "anything", 0, nil},
+		{"x", "abc", -1, nil},
+		{"ba", "ab", -1, nil},
+		// Start of s: +3; consecutive: +2.
+		{"prl", "Println", 8, []int{0, 1, 5}},
+		{"AB", "ab", 7, []int{0, 1}},
+		// Word boundaries: after '_', '.', '/' and at a lower-to-upper change: +2.
+		{"ab", "a_b", 7, []int{0, 2}},
+		{"ab", "a.b", 7, []int{0, 2}},
+		{"ab", "a/b", 7, []int{0, 2}},
+		{"fb", "fooBar", 7, []int{0, 3}},
+		{"b", "ab", 1, []int{1}},
+		{"b", "aB", 3, []int{1}},
+	}
+	for _, tt := range tests {
+		score, matched := FuzzyMatch(tt.pattern, tt.s)
+		if score != tt.score || !slices.Equal(matched, tt.matched) {
+			t.Errorf("FuzzyMatch(%q, %q) = %d, %v; want %d, %v", tt.pattern, tt.s, score, matched, tt.score, tt.matched)
+		}
+	}
+}
+
+func TestCompletionRankerRank(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		keys    []RankKey
+		history []string
+		want    []int
+	}{
+		{
+			name:    "by score",
+			pattern: "ap",
+			keys:    []RankKey{{Label: "ample"}, {Label: "apple"}, {Label: "xyz"}},
+			want:    []int{1, 0},
+		},
+		{
+			name:    "recently accepted first",
+			pattern: "ap",
+			keys:    []RankKey{{Label: "ample"}, {Label: "apple"}},
+			history: []string{"ample"},
+			want:    []int{0, 1},
+		},
+		{
+			name: "sort text breaks ties",
+			keys: []RankKey{{Label: "a", Sort: "2"}, {Label: "b", Sort: "1"}},
+			want: []int{1, 0},
+		},
+		{
+			name: "label breaks ties",
+			keys: []RankKey{{Label: "b"}, {Label: "a"}},
+			want: []int{1, 0},
+		},
+		{
+			name:    "filter text is matched",
+			pattern: "ab",
+			keys:    []RankKey{{Label: "x", Filter: "ab"}, {Label: "ab", Filter: "zz"}},
+			want:    []int{0},
+		},
+	}
+	for _, tt := range tests {
+		var history CompletionHistory
+		for _, label := range tt.history {
+			history.Add(label)
+		}
+		r := CompletionRanker{History: &history}
+		if got := r.Rank(tt.pattern, tt.keys); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Rank(%q) = %v, want %v", tt.name, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestCompletionRankerMatchesAndAccept(t *testing.T) {
+	var history CompletionHistory
+	r := CompletionRanker{History: &history}
+	r.Rank("pl", []RankKey{{Label: "xyz"}, {Label: "Println"}, {Label: "fmt", Filter: "pl"}})
+	// "fmt" ranks first by its filter text, but its label is what is highlighted.
+	for i, want := range [][]int{nil, {0, 5}} {
+		if got := r.Matches(i); !slices.Equal(got, want) {
+			t.Errorf("Matches(%d) = %v, want %v", i, got, want)
+		}
+	}
+	if got := r.Matches(2); got != nil {
+		t.Errorf("Matches(2) = %v, want nil", got)
+	}
+	r.Accept(0)
+	if !history.contains("fmt") || history.contains("Println") {
+		t.Errorf("Accept(0) recorded %v, want [fmt]", history.labels)
+	}
+}
+
+func TestCompletionHistoryAdd(t *testing.T) {
+	var h CompletionHistory
+	for i := range maxCompletionHistory + 10 {
+		h.Add(fmt.Sprint(i))
+	}
+	h.Add("20")
+	if len(h.labels) != maxCompletionHistory {
+		t.Fatalf("len = %d, want %d", len(h.labels), maxCompletionHistory)
+	}
+	if h.labels[0] != "20" || h.labels[1] != fmt.Sprint(maxCompletionHistory+9) {
+		t.Errorf("labels start with %v, want the most recent first", h.labels[:2])
+	}
+	if h.contains("5") {
+		t.Errorf("the oldest labels were kept")
+	}
+	if slices.Index(h.labels[1:], "20") >= 0 {
+		t.Errorf("re-added label is listed twice")
+	}
+}
@@ -0,0 +1,106 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.lsp.dev/protocol"
+)
+
+// HierarchyItem is an item of a call or type hierarchy (CallHierarchyItem, TypeHierarchyItem),
+// which have the same shape. Data must be sent back to the server unchanged.
+type HierarchyItem struct {
+	Name           string               `json:"name"`
+	Kind           protocol.SymbolKind  `json:"kind"`
+	Tags           []protocol.SymbolTag `json:"tags,omitempty"`
+	Detail         string               `json:"detail,omitempty"`
+	URI            protocol.DocumentURI `json:"uri"`
+	Range          protocol.Range       `json:"range"`
+	SelectionRange protocol.Range       `json:"selectionRange"`
+	Data           json.RawMessage      `json:"data,omitempty"`
+}
+
+// HierarchyCall is an incoming or outgoing call: the calling or called item, and the ranges of
+// the calls. For incoming calls the ranges are in the caller, Item; for outgoing calls they are
+// in the item the calls were requested for.
+type HierarchyCall struct {
+	Item   HierarchyItem
+	Ranges []protocol.Range
+}
+
+// PrepareCallHierarchy requests textDocument/prepareCallHierarchy for the symbol at the position.
+func (c *Client) PrepareCallHierarchy(ctx context.Context, docURI protocol.DocumentURI, line, character uint32) ([]HierarchyItem, error) {
+	return c.prepareHierarchy(ctx, protocol.MethodTextDocumentPrepareCallHierarchy, docURI, line, character)
+}
+
+// PrepareTypeHierarchy requests textDocument/prepareTypeHierarchy for the symbol at the position.
+func (c *Client) PrepareTypeHierarchy(ctx context.Context, docURI protocol.DocumentURI, line, character uint32) ([]HierarchyItem, error) {
+	return c.prepareHierarchy(ctx, MethodTextDocumentPrepareTypeHierarchy, docURI, line, character)
+}
+
+func (c *Client) prepareHierarchy(ctx context.Context, method string, docURI protocol.DocumentURI, line, character uint32) ([]HierarchyItem, error) {
+	params := &protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: docURI},
+		Position:     protocol.Position{Line: line, Character: character},
+	}
+	var items []HierarchyItem
+	if _, err := c.rpc().Call(ctx, method, params, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// IncomingCalls requests callHierarchy/incomingCalls: the callers of item.
+func (c *Client) IncomingCalls(ctx context.Context, item HierarchyItem) ([]HierarchyCall, error) {
+	var raw []struct {
+		From       HierarchyItem    `json:"from"`
+		FromRanges []protocol.Range `json:"fromRanges"`
+	}
+	if _, err := c.rpc().Call(ctx, protocol.MethodCallHierarchyIncomingCalls, hierarchyParams{item}, &raw); err != nil {
+		return nil, err
+	}
+	calls := make([]HierarchyCall, len(raw))
+	for i, r := range raw {
+		calls[i] = HierarchyCall{Item: r.From, Ranges: r.FromRanges}
+	}
+	return calls, nil
+}
+
+// OutgoingCalls requests callHierarchy/outgoingCalls: the functions item calls.
+func (c *Client) OutgoingCalls(ctx context.Context, item HierarchyItem) ([]HierarchyCall, error) {
+	var raw []struct {
+		To         HierarchyItem    `json:"to"`
+		FromRanges []protocol.Range `json:"fromRanges"`
+	}
+	if _, err := c.rpc().Call(ctx, protocol.MethodCallHierarchyOutgoingCalls, hierarchyParams{item}, &raw); err != nil {
+		return nil, err
+	}
+	calls := make([]HierarchyCall, len(raw))
+	for i, r := range raw {
+		calls[i] = HierarchyCall{Item: r.To, Ranges: r.FromRanges}
+	}
+	return calls, nil
+}
+
+// Supertypes requests typeHierarchy/supertypes: the types item extends or implements.
+func (c *Client) Supertypes(ctx context.Context, item HierarchyItem) ([]HierarchyItem, error) {
+	var items []HierarchyItem
+	if _, err := c.rpc().Call(ctx, MethodTypeHierarchySupertypes, hierarchyParams{item}, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Subtypes requests typeHierarchy/subtypes: the types extending or implementing item.
+func (c *Client) Subtypes(ctx context.Context, item HierarchyItem) ([]HierarchyItem, error) {
+	var items []HierarchyItem
+	if _, err := c.rpc().Call(ctx, MethodTypeHierarchySubtypes, hierarchyParams{item}, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// hierarchyParams are the params of the requests for an item's relatives in a hierarchy.
+type hierarchyParams struct {
+	Item HierarchyItem `json:"item"`
+}
@@ -0,0 +1,66 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// InlayHintKind is the kind of an inlay hint (LSP 3.17).
+type InlayHintKind int
+
+// InlayHintKindType marks a type hint, e.g. the inferred type after a := assignment.
+const InlayHintKindType InlayHintKind = 1
+
+// InlayHint is a textDocument/inlayHint result entry, decoded for display.
+type InlayHint struct {
+	Position protocol.Position
+	Label    string // label parts are joined
+	Kind     InlayHintKind
+}
+
+// InlayHints requests textDocument/inlayHint for the hints in rng.
+func (c *Client) InlayHints(ctx context.Context, docURI protocol.DocumentURI, rng protocol.Range) ([]InlayHint, error) {
+	params := struct {
+		TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+		Range        protocol.Range                  `json:"range"`
+	}{protocol.TextDocumentIdentifier{URI: docURI}, rng}
+	var raw []struct {
+		Position protocol.Position `json:"position"`
+		Label    json.RawMessage   `json:"label"`
+		Kind     InlayHintKind     `json:"kind"`
+	}
+	if _, err := c.rpc().Call(ctx, MethodTextDocumentInlayHint, params, &raw); err != nil {
+		return nil, err
+	}
+	hints := make([]InlayHint, 0, len(raw))
+	for _, h := range raw {
+		hints = append(hints, InlayHint{
+			Position: h.Position,
+			Label:    inlayHintLabel(h.Label),
+			Kind:     h.Kind,
+		})
+	}
+	return hints, nil
+}
+
+// inlayHintLabel decodes an inlay hint label: a string or a list of label parts.
+func inlayHintLabel(data json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s
+	}
+	var parts []struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		b.WriteString(p.Value)
+	}
+	return b.String()
+}
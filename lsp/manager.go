@@ -2,15 +2,42 @@ package lsp
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"path/filepath"
+	"slices"
 	"sync"
+	"time"
+
+	"go.lsp.dev/protocol"
+)
+
+// Restart limits for servers that exit unexpectedly: the delay before a restart doubles with
+// every recent restart, and a server that needed maxRestarts restarts within restartWindow is
+// given up on.
+const (
+	restartDelay    = time.Second
+	maxRestartDelay = 30 * time.Second
+	maxRestarts     = 5
+	restartWindow   = 3 * time.Minute
 )
 
+// ErrNoWorkspaceSymbolServer is returned by WorkspaceSymbols when no running server can search
+// workspace symbols.
+var ErrNoWorkspaceSymbolServer = errors.New("no running language server supports workspace symbols")
+
+// NotifyHandler shows a message about a language server (e.g. that it crashed) to the user.
+type NotifyHandler func(message string)
+
 // Manager caches LSP clients per (rootURI, languageID) so one server is shared for all files of that language in a project.
+// Servers that exit unexpectedly are restarted in place, see watch.
 type Manager struct {
-	config *Config
-	mu     sync.Mutex
-	byKey  map[string]*Client
+	config    *Config
+	mu        sync.Mutex
+	byKey     map[string]*Client
+	applyEdit ApplyEditHandler
+	notify    NotifyHandler
 }
 
 // NewManager creates a manager that uses the given config to start servers.
@@ -25,6 +52,11 @@ func (m *Manager) key(rootURI, languageID string) string {
 	return rootURI + "\x00" + languageID
 }
 
+// ServerForFile returns the configured server entry for filePath, or nil if there is none.
+func (m *Manager) ServerForFile(filePath string) *ServerEntry {
+	return m.config.ServerForFile(filePath)
+}
+
 // ClientFor returns an LSP client for the given file path. It uses projectRoot as workspace root
 // and picks the server from config by file extension. Returns nil if no server is configured.
 func (m *Manager) ClientFor(ctx context.Context, projectRoot, filePath string) (*Client, error) {
@@ -45,7 +77,7 @@ func (m *Manager) ClientFor(ctx context.Context, projectRoot, filePath string) (
 	}
 	m.mu.Unlock()
 
-	c, err := NewClient(ctx, rootURI, entry.Command, entry.Args)
+	c, err := NewClient(ctx, rootURI, entry.Command, entry.Args, entry.InitializationOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -57,10 +89,141 @@ func (m *Manager) ClientFor(ctx context.Context, projectRoot, filePath string) (
 		return existing, nil
 	}
 	m.byKey[k] = c
+	c.SetApplyEditHandler(m.applyEdit)
 	m.mu.Unlock()
+	go m.watch(k, filepath.Base(entry.Command), c)
 	return c, nil
 }
 
+// watch restarts c's server whenever it exits without the client being closed, backing off
+// between attempts. When the server keeps crashing, c is dropped so the next ClientFor starts
+// a fresh one.
+func (m *Manager) watch(k, name string, c *Client) {
+	var restarts []time.Time
+	for {
+		<-c.done()
+		ctx, cancel := context.WithTimeout(context.Background(), processExitTimeout)
+		err := c.wait(ctx)
+		cancel()
+		if c.isClosed() {
+			return
+		}
+		if err != nil {
+			m.notifyf("%s exited unexpectedly (%v), restarting", name, err)
+		} else {
+			m.notifyf("%s exited unexpectedly, restarting", name)
+		}
+		for {
+			now := time.Now()
+			restarts = slices.DeleteFunc(restarts, func(t time.Time) bool { return now.Sub(t) > restartWindow })
+			if len(restarts) >= maxRestarts {
+				m.notifyf("%s crashed %d times in %v, not restarting it again", name, len(restarts), restartWindow)
+				m.mu.Lock()
+				if m.byKey[k] == c {
+					delete(m.byKey, k)
+				}
+				m.mu.Unlock()
+				_ = c.Close()
+				return
+			}
+			time.Sleep(min(restartDelay<<len(restarts), maxRestartDelay))
+			if c.isClosed() {
+				return
+			}
+			restarts = append(restarts, time.Now())
+			if err := c.restart(context.Background()); err != nil {
+				log.Printf("[LSP] restart %s: %v", name, err)
+				continue
+			}
+			break
+		}
+		m.notifyf("%s restarted", name)
+	}
+}
+
+// notifyf formats a message, logs it and passes it to the notify handler.
+func (m *Manager) notifyf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("[LSP] %s", msg)
+	m.mu.Lock()
+	fn := m.notify
+	m.mu.Unlock()
+	if fn != nil {
+		fn(msg)
+	}
+}
+
+// SetNotifyHandler sets the handler for messages about servers, e.g. that one crashed and was restarted.
+func (m *Manager) SetNotifyHandler(fn NotifyHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notify = fn
+}
+
+// CloseAll shuts down every server concurrently and forgets their clients. Servers that don't
+// exit before ctx is done are killed.
+func (m *Manager) CloseAll(ctx context.Context) error {
+	m.mu.Lock()
+	clients := make([]*Client, 0, len(m.byKey))
+	for _, c := range m.byKey {
+		clients = append(clients, c)
+	}
+	clear(m.byKey)
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(clients))
+	for i, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// WorkspaceSymbols sends workspace/symbol with query to every running server that supports it,
+// concurrently, and merges their results. Servers that fail are reported in the returned error,
+// alongside the results of the others.
+func (m *Manager) WorkspaceSymbols(ctx context.Context, query string) ([]protocol.SymbolInformation, error) {
+	m.mu.Lock()
+	clients := make([]*Client, 0, len(m.byKey))
+	for _, c := range m.byKey {
+		if c.Supports(protocol.MethodWorkspaceSymbol) {
+			clients = append(clients, c)
+		}
+	}
+	m.mu.Unlock()
+	if len(clients) == 0 {
+		return nil, ErrNoWorkspaceSymbolServer
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]protocol.SymbolInformation, len(clients))
+	errs := make([]error, len(clients))
+	for i, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = c.WorkspaceSymbols(ctx, query)
+		}()
+	}
+	wg.Wait()
+	return slices.Concat(results...), errors.Join(errs...)
+}
+
+// SetApplyEditHandler sets the workspace/applyEdit handler on all current and future clients.
+func (m *Manager) SetApplyEditHandler(fn ApplyEditHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.applyEdit = fn
+	for _, c := range m.byKey {
+		c.SetApplyEditHandler(fn)
+	}
+}
+
 // RootURIFromPath returns a file URI for the given directory path (workspace root).
 func RootURIFromPath(projectRoot string) string {
 	abs, err := filepath.Abs(projectRoot)
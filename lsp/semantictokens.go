@@ -0,0 +1,175 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"go.lsp.dev/protocol"
+)
+
+// SemanticTokens is a document's token stream as last returned by the server, still in the
+// protocol's relative encoding. ResultID lets the next request ask for just the changes.
+type SemanticTokens struct {
+	ResultID string
+	Data     []uint32
+}
+
+// SemanticToken is one decoded semantic token. Start and End are rune offsets in the document.
+type SemanticToken struct {
+	Start, End int
+	Type       string
+	Modifiers  []string
+}
+
+// semanticTokenTypes and semanticTokenModifiers are the token types and modifiers announced to
+// servers: the ones predefined by the protocol.
+var (
+	semanticTokenTypes = []string{
+		"namespace", "type", "class", "enum", "interface", "struct", "typeParameter", "parameter",
+		"variable", "property", "enumMember", "event", "function", "method", "macro", "keyword",
+		"modifier", "comment", "string", "number", "regexp", "operator", "decorator", "label",
+	}
+	semanticTokenModifiers = []string{
+		"declaration", "definition", "readonly", "static", "deprecated", "abstract", "async",
+		"modification", "documentation", "defaultLibrary",
+	}
+)
+
+// errBadSemanticTokensDelta is returned when a delta does not fit the tokens it is meant for.
+var errBadSemanticTokensDelta = errors.New("semantic tokens delta does not match the previous result")
+
+// SemanticTokens requests textDocument/semanticTokens/full for the document. If prev has a result
+// ID and the server supports deltas, textDocument/semanticTokens/full/delta is requested instead
+// and applied to prev. It returns nil if the server has no tokens for the document.
+func (c *Client) SemanticTokens(ctx context.Context, docURI protocol.DocumentURI, prev *SemanticTokens) (*SemanticTokens, error) {
+	doc := protocol.TextDocumentIdentifier{URI: docURI}
+	if prev != nil && prev.ResultID != "" && c.Supports(protocol.MethodSemanticTokensFullDelta) {
+		params := &protocol.SemanticTokensDeltaParams{TextDocument: doc, PreviousResultID: prev.ResultID}
+		var raw json.RawMessage
+		if _, err := c.rpc().Call(ctx, protocol.MethodSemanticTokensFullDelta, params, &raw); err != nil {
+			return nil, err
+		}
+		tokens, err := decodeSemanticTokensDelta(raw, prev)
+		if !errors.Is(err, errBadSemanticTokensDelta) {
+			return tokens, err
+		}
+	}
+	var raw json.RawMessage
+	if _, err := c.rpc().Call(ctx, protocol.MethodSemanticTokensFull, &protocol.SemanticTokensParams{TextDocument: doc}, &raw); err != nil {
+		return nil, err
+	}
+	if isNull(raw) {
+		return nil, nil
+	}
+	var result protocol.SemanticTokens
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	return &SemanticTokens{ResultID: result.ResultID, Data: result.Data}, nil
+}
+
+// decodeSemanticTokensDelta decodes a textDocument/semanticTokens/full/delta result, which is
+// either a full result or edits to prev.
+func decodeSemanticTokensDelta(raw json.RawMessage, prev *SemanticTokens) (*SemanticTokens, error) {
+	if isNull(raw) {
+		return nil, nil
+	}
+	var result struct {
+		ResultID string                        `json:"resultId"`
+		Data     []uint32                      `json:"data"`
+		Edits    []protocol.SemanticTokensEdit `json:"edits"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	if result.Edits == nil {
+		return &SemanticTokens{ResultID: result.ResultID, Data: result.Data}, nil
+	}
+	edits := slices.Clone(result.Edits)
+	slices.SortStableFunc(edits, func(a, b protocol.SemanticTokensEdit) int { return int(a.Start) - int(b.Start) })
+	data := make([]uint32, 0, len(prev.Data))
+	pos := 0
+	for _, e := range edits {
+		start, end := int(e.Start), int(e.Start)+int(e.DeleteCount)
+		if start < pos || end > len(prev.Data) {
+			return nil, errBadSemanticTokensDelta
+		}
+		data = append(data, prev.Data[pos:start]...)
+		data = append(data, e.Data...)
+		pos = end
+	}
+	data = append(data, prev.Data[pos:]...)
+	return &SemanticTokens{ResultID: result.ResultID, Data: data}, nil
+}
+
+// isNull reports whether a raw result is absent or JSON null.
+func isNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(raw) == "null"
+}
+
+// semanticTokensLegend returns the legend from the server's semanticTokensProvider capability.
+func (c *Client) semanticTokensLegend() protocol.SemanticTokensLegend {
+	c.mu.Lock()
+	value := c.rawCapabilities["semanticTokensProvider"]
+	c.mu.Unlock()
+	var provider struct {
+		Legend protocol.SemanticTokensLegend `json:"legend"`
+	}
+	_ = json.Unmarshal(value, &provider)
+	return provider.Legend
+}
+
+// DecodeSemanticTokens decodes tokens, which the server computed for text, using the server's
+// legend. Tokens of types missing from the legend are dropped.
+func (c *Client) DecodeSemanticTokens(text string, tokens *SemanticTokens) []SemanticToken {
+	if tokens == nil {
+		return nil
+	}
+	legend := c.semanticTokensLegend()
+	lines := strings.Split(text, "\n")
+	data := tokens.Data
+	decoded := make([]SemanticToken, 0, len(data)/5)
+	var line, char uint32
+	// lineStart is the rune offset of lines[lineIdx]; runes is that line, decoded on first use.
+	lineStart, lineIdx := 0, 0
+	var runes []rune
+	for i := 0; i+5 <= len(data); i += 5 {
+		if data[i] > 0 {
+			line += data[i]
+			char = data[i+1]
+		} else {
+			char += data[i+1]
+		}
+		length, typ, mods := data[i+2], data[i+3], data[i+4]
+		if int(line) >= len(lines) {
+			break
+		}
+		for lineIdx < int(line) {
+			lineStart += utf8.RuneCountInString(lines[lineIdx]) + 1
+			lineIdx++
+			runes = nil
+		}
+		if int(typ) >= len(legend.TokenTypes) {
+			continue
+		}
+		if runes == nil {
+			runes = []rune(lines[lineIdx])
+		}
+		tok := SemanticToken{
+			Start: lineStart + utf16ToRuneCol(runes, int(char)),
+			End:   lineStart + utf16ToRuneCol(runes, int(char+length)),
+			Type:  string(legend.TokenTypes[typ]),
+		}
+		for bit, mod := range legend.TokenModifiers {
+			if mods&(1<<bit) != 0 {
+				tok.Modifiers = append(tok.Modifiers, string(mod))
+			}
+		}
+		decoded = append(decoded, tok)
+	}
+	return decoded
+}
@@ -0,0 +1,102 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeSemanticTokensDelta(t *testing.T) {
+	prev := &SemanticTokens{ResultID: "1", Data: []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}}
+	tests := []struct {
+		name string
+		raw  string
+		want *SemanticTokens
+		err  error
+	}{
+		{"null", "null", nil, nil},
+		{"empty", "", nil, nil},
+		{"full result", `{"resultId":"2","data":[1,2,3,4,5]}`, &SemanticTokens{ResultID: "2", Data: []uint32{1, 2, 3, 4, 5}}, nil},
+		{"no edits", `{"resultId":"2","edits":[]}`, &SemanticTokens{ResultID: "2", Data: prev.Data}, nil},
+		{
+			name: "replace",
+			raw:  `{"resultId":"2","edits":[{"start":2,"deleteCount":3,"data":[20,30]}]}`,
+			want: &SemanticTokens{ResultID: "2", Data: []uint32{0, 1, 20, 30, 5, 6, 7, 8, 9}},
+		},
+		{
+			name: "insert and delete at the ends",
+			raw:  `{"resultId":"2","edits":[{"start":10,"deleteCount":0,"data":[10]},{"start":0,"deleteCount":1}]}`,
+			want: &SemanticTokens{ResultID: "2", Data: []uint32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		},
+		{
+			name: "unsorted edits",
+			raw:  `{"resultId":"2","edits":[{"start":8,"deleteCount":1,"data":[80]},{"start":1,"deleteCount":1,"data":[10]}]}`,
+			want: &SemanticTokens{ResultID: "2", Data: []uint32{0, 10, 2, 3, 4, 5, 6, 7, 80, 9}},
+		},
+		{"overlapping edits", `{"edits":[{"start":1,"deleteCount":3},{"start":2,"deleteCount":1}]}`, nil, errBadSemanticTokensDelta},
+		{"edit past the end", `{"edits":[{"start":8,"deleteCount":5}]}`, nil, errBadSemanticTokensDelta},
+	}
+	for _, tt := range tests {
+		got, err := decodeSemanticTokensDelta(json.RawMessage(tt.raw), prev)
+		if !errors.Is(err, tt.err) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, %v; want %+v, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestDecodeSemanticTokens(t *testing.T) {
+	c := &Client{rawCapabilities: map[string]json.RawMessage{
+		"semanticTokensProvider": json.RawMessage(`{"legend":{"tokenTypes":["keyword","variable"],"tokenModifiers":["declaration","readonly"]}}`),
+	}}
+	// "𝒳" is one rune but two UTF-16 code units.
+	text := "package main\nvar 𝒳é = 1\n"
+	tests := []struct {
+		name string
+		data []uint32
+		want []SemanticToken
+	}{
+		{"no tokens", nil, []SemanticToken{}},
+		{
+			name: "relative positions",
+			data: []uint32{0, 0, 7, 0, 0, 1, 0, 3, 0, 0, 0, 4, 3, 1, 3},
+			want: []SemanticToken{
+				{Start: 0, End: 7, Type: "keyword"},
+				{Start: 13, End: 16, Type: "keyword"},
+				{Start: 17, End: 19, Type: "variable", Modifiers: []string{"declaration", "readonly"}},
+			},
+		},
+		{
+			name: "utf-16 columns",
+			data: []uint32{1, 6, 1, 1, 0, 0, 4, 1, 0, 2},
+			want: []SemanticToken{
+				{Start: 18, End: 19, Type: "variable"},
+				{Start: 22, End: 23, Type: "keyword", Modifiers: []string{"readonly"}},
+			},
+		},
+		{
+			name: "type outside the legend",
+			data: []uint32{0, 0, 7, 5, 0, 1, 4, 3, 1, 0},
+			want: []SemanticToken{{Start: 17, End: 19, Type: "variable"}},
+		},
+		{
+			name: "line past the text",
+			data: []uint32{0, 0, 7, 0, 0, 5, 0, 1, 0, 0},
+			want: []SemanticToken{{Start: 0, End: 7, Type: "keyword"}},
+		},
+		{
+			name: "truncated data",
+			data: []uint32{0, 0, 7, 0, 0, 1, 0},
+			want: []SemanticToken{{Start: 0, End: 7, Type: "keyword"}},
+		},
+	}
+	for _, tt := range tests {
+		got := c.DecodeSemanticTokens(text, &SemanticTokens{Data: tt.data})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v; want %+v", tt.name, got, tt.want)
+		}
+	}
+	if got := c.DecodeSemanticTokens(text, nil); got != nil {
+		t.Errorf("nil tokens: got %+v; want nil", got)
+	}
+}
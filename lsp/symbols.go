@@ -0,0 +1,117 @@
+package lsp
+
+import (
+	"context"
+	"slices"
+
+	"go.lsp.dev/protocol"
+)
+
+// DocumentSymbols requests textDocument/documentSymbol. Servers answer with either a
+// DocumentSymbol tree or a flat SymbolInformation list; a flat list is nested by range.
+func (c *Client) DocumentSymbols(ctx context.Context, docURI protocol.DocumentURI) ([]protocol.DocumentSymbol, error) {
+	params := &protocol.DocumentSymbolParams{TextDocument: protocol.TextDocumentIdentifier{URI: docURI}}
+	var raw []struct {
+		protocol.DocumentSymbol
+		Location *protocol.Location `json:"location"`
+	}
+	if _, err := c.rpc().Call(ctx, protocol.MethodTextDocumentDocumentSymbol, params, &raw); err != nil {
+		return nil, err
+	}
+	symbols := make([]protocol.DocumentSymbol, len(raw))
+	flat := false
+	for i, r := range raw {
+		symbols[i] = r.DocumentSymbol
+		if r.Location != nil {
+			flat = true
+			symbols[i].Range = r.Location.Range
+			symbols[i].SelectionRange = r.Location.Range
+		}
+	}
+	if flat {
+		return nestSymbols(symbols), nil
+	}
+	return symbols, nil
+}
+
+// nestSymbols turns a flat symbol list into a tree: each symbol becomes a child of the smallest
+// symbol whose range contains it.
+func nestSymbols(flat []protocol.DocumentSymbol) []protocol.DocumentSymbol {
+	type node struct {
+		symbol   protocol.DocumentSymbol
+		children []*node
+	}
+	flat = slices.Clone(flat)
+	slices.SortStableFunc(flat, func(a, b protocol.DocumentSymbol) int {
+		if c := comparePositions(a.Range.Start, b.Range.Start); c != 0 {
+			return c
+		}
+		return comparePositions(b.Range.End, a.Range.End) // outer symbols first
+	})
+	var roots []*node
+	var stack []*node // the symbols containing the current one, innermost last
+	for _, s := range flat {
+		n := &node{symbol: s}
+		for len(stack) > 0 && comparePositions(stack[len(stack)-1].symbol.Range.End, s.Range.End) < 0 {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, n)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, n)
+		}
+		stack = append(stack, n)
+	}
+	var build func(nodes []*node) []protocol.DocumentSymbol
+	build = func(nodes []*node) []protocol.DocumentSymbol {
+		symbols := make([]protocol.DocumentSymbol, len(nodes))
+		for i, n := range nodes {
+			symbols[i] = n.symbol
+			if len(n.children) > 0 {
+				symbols[i].Children = build(n.children)
+			}
+		}
+		return symbols
+	}
+	return build(roots)
+}
+
+// comparePositions orders positions by line, then character.
+func comparePositions(a, b protocol.Position) int {
+	if a.Line != b.Line {
+		return int(a.Line) - int(b.Line)
+	}
+	return int(a.Character) - int(b.Character)
+}
+
+// WorkspaceSymbols requests workspace/symbol for the symbols matching query. Results given as
+// WorkspaceSymbols (LSP 3.17) whose location has no range point at the start of their file.
+func (c *Client) WorkspaceSymbols(ctx context.Context, query string) ([]protocol.SymbolInformation, error) {
+	var raw []struct {
+		Name          string              `json:"name"`
+		Kind          protocol.SymbolKind `json:"kind"`
+		ContainerName string              `json:"containerName"`
+		Location      struct {
+			URI   protocol.DocumentURI `json:"uri"`
+			Range *protocol.Range      `json:"range"`
+		} `json:"location"`
+	}
+	if _, err := c.rpc().Call(ctx, protocol.MethodWorkspaceSymbol, &protocol.WorkspaceSymbolParams{Query: query}, &raw); err != nil {
+		return nil, err
+	}
+	symbols := make([]protocol.SymbolInformation, 0, len(raw))
+	for _, r := range raw {
+		sym := protocol.SymbolInformation{
+			Name:          r.Name,
+			Kind:          r.Kind,
+			ContainerName: r.ContainerName,
+			Location:      protocol.Location{URI: r.Location.URI},
+		}
+		if r.Location.Range != nil {
+			sym.Location.Range = *r.Location.Range
+		}
+		symbols = append(symbols, sym)
+	}
+	return symbols, nil
+}
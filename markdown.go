@@ -0,0 +1,370 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"strings"
+
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"gioui.org/x/richtext"
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/chapar-rest/uikit/theme"
+)
+
+// mdBlockKind is the kind of a block-level markdown element.
+type mdBlockKind int
+
+const (
+	mdParagraph mdBlockKind = iota
+	mdHeading
+	mdListItem
+	mdCode
+	mdRule
+)
+
+// mdInline is a run of inline text sharing one style.
+type mdInline struct {
+	text   string
+	code   bool
+	bold   bool
+	italic bool
+	url    string // non-empty for links
+}
+
+// mdBlock is one block-level element of a parsed markdown document.
+type mdBlock struct {
+	kind    mdBlockKind
+	level   int    // heading level (1-6)
+	marker  string // list bullet or number, e.g. "•" or "2."
+	lang    string // code fence language
+	inlines []mdInline
+	code    string
+	spans   codeHighlight // highlighted code, lexed on first layout
+	state   richtext.InteractiveText
+}
+
+// markdownView renders the subset of markdown language servers use in hover and documentation
+// (headings, paragraphs, lists, rules, code fences, inline code, emphasis and links).
+// Code fences are highlighted with the same chroma style as the editor.
+type markdownView struct {
+	src    string
+	blocks []*mdBlock
+	list   widget.List
+	// OnLink is called when a link is clicked.
+	OnLink func(url string)
+}
+
+// SetText parses md if it differs from the current source.
+func (v *markdownView) SetText(md string) {
+	if md == v.src && v.blocks != nil {
+		return
+	}
+	v.src = md
+	v.blocks = parseMarkdown(md)
+	v.list.Position = layout.Position{}
+}
+
+// SetPlainText shows s verbatim, as a single paragraph per line.
+func (v *markdownView) SetPlainText(s string) {
+	if s == v.src && v.blocks != nil {
+		return
+	}
+	v.src = s
+	v.blocks = v.blocks[:0]
+	for _, line := range strings.Split(s, "\n") {
+		v.blocks = append(v.blocks, &mdBlock{kind: mdParagraph, inlines: []mdInline{{text: line}}})
+	}
+	v.list.Position = layout.Position{}
+}
+
+// Layout draws the document as a vertically scrollable list of blocks.
+func (v *markdownView) Layout(gtx layout.Context, th *theme.Theme, textSize unit.Sp) layout.Dimensions {
+	mat := th.Material()
+	v.list.Axis = layout.Vertical
+	li := material.List(mat, &v.list)
+	li.AnchorStrategy = material.Overlay
+	return li.Layout(gtx, len(v.blocks), func(gtx layout.Context, i int) layout.Dimensions {
+		b := v.blocks[i]
+		for {
+			span, ev, ok := b.state.Update(gtx)
+			if !ok {
+				break
+			}
+			if ev.Type == richtext.Click && v.OnLink != nil {
+				if url, ok := span.Get("url").(string); ok && url != "" {
+					v.OnLink(url)
+				}
+			}
+		}
+		inset := layout.Inset{Bottom: unit.Dp(4)}
+		if i == len(v.blocks)-1 {
+			inset.Bottom = 0
+		}
+		return inset.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			return v.layoutBlock(gtx, th, b, textSize)
+		})
+	})
+}
+
+func (v *markdownView) layoutBlock(gtx layout.Context, th *theme.Theme, b *mdBlock, textSize unit.Sp) layout.Dimensions {
+	mat := th.Material()
+	switch b.kind {
+	case mdRule:
+		h := gtx.Dp(unit.Dp(1))
+		size := image.Pt(gtx.Constraints.Max.X, h)
+		paint.FillShape(gtx.Ops, th.Base.Border, clip.Rect{Max: size}.Op())
+		return layout.Dimensions{Size: size}
+	case mdCode:
+		spans := b.spans.get(b.code, b.lang, mat.Fg, textSize)
+		macro := op.Record(gtx.Ops)
+		dims := layout.UniformInset(unit.Dp(6)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			return richtext.Text(&b.state, mat.Shaper, spans...).Layout(gtx)
+		})
+		call := macro.Stop()
+		rr := clip.UniformRRect(image.Rectangle{Max: dims.Size}, gtx.Dp(unit.Dp(4)))
+		paint.FillShape(gtx.Ops, th.Base.Surface, rr.Op(gtx.Ops))
+		call.Add(gtx.Ops)
+		return dims
+	case mdListItem:
+		return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				lbl := material.Label(mat, textSize, b.marker)
+				lbl.Color = th.Base.TextSubtle
+				return layout.Inset{Left: unit.Dp(4), Right: unit.Dp(6)}.Layout(gtx, lbl.Layout)
+			}),
+			layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+				return richtext.Text(&b.state, mat.Shaper, inlineSpans(th, b.inlines, textSize, font.Font{})...).Layout(gtx)
+			}),
+		)
+	case mdHeading:
+		size := textSize + unit.Sp(max(0, 4-b.level)*2)
+		return richtext.Text(&b.state, mat.Shaper, inlineSpans(th, b.inlines, size, font.Font{Weight: font.Bold})...).Layout(gtx)
+	default:
+		return richtext.Text(&b.state, mat.Shaper, inlineSpans(th, b.inlines, textSize, font.Font{})...).Layout(gtx)
+	}
+}
+
+// inlineSpans converts inline runs to rich text spans; base carries block-level font attributes.
+func inlineSpans(th *theme.Theme, inlines []mdInline, size unit.Sp, base font.Font) []richtext.SpanStyle {
+	spans := make([]richtext.SpanStyle, 0, len(inlines))
+	for _, in := range inlines {
+		ss := richtext.SpanStyle{
+			Font:    base,
+			Size:    size,
+			Color:   th.Base.Text,
+			Content: in.text,
+		}
+		if in.code {
+			ss.Font = EditorFont()
+			ss.Color = th.Base.Notice
+		}
+		if in.bold {
+			ss.Font.Weight = font.Bold
+		}
+		if in.italic {
+			ss.Font.Style = font.Italic
+		}
+		if in.url != "" {
+			ss.Color = th.Base.Info
+			ss.Interactive = true
+			ss.Set("url", in.url)
+		}
+		spans = append(spans, ss)
+	}
+	return spans
+}
+
+// codeSpans highlights code through chroma using the editor's chroma style.
+func codeSpans(code, lang string, fg color.NRGBA, size unit.Sp) []richtext.SpanStyle {
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		lexer = lexers.Analyse(code)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	style := editorChromaStyle()
+	plain := []richtext.SpanStyle{{Font: EditorFont(), Size: size, Color: fg, Content: code}}
+	it, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return plain
+	}
+	var spans []richtext.SpanStyle
+	for t := it(); t != chroma.EOF; t = it() {
+		if t.Value == "" {
+			continue
+		}
+		c, ok := chromaTokenColor(style, t.Type)
+		if !ok {
+			c = fg
+		}
+		spans = append(spans, richtext.SpanStyle{Font: EditorFont(), Size: size, Color: c, Content: t.Value})
+	}
+	if len(spans) == 0 {
+		return plain
+	}
+	return spans
+}
+
+// codeHighlight caches the codeSpans of a piece of code, so it is lexed again only when the code
+// or its style changes rather than every frame.
+type codeHighlight struct {
+	code, lang string
+	fg         color.NRGBA
+	size       unit.Sp
+	spans      []richtext.SpanStyle
+}
+
+// get returns codeSpans(code, lang, fg, size), reusing the previous result if the arguments are
+// the same.
+func (h *codeHighlight) get(code, lang string, fg color.NRGBA, size unit.Sp) []richtext.SpanStyle {
+	if h.spans == nil || code != h.code || lang != h.lang || fg != h.fg || size != h.size {
+		h.code, h.lang, h.fg, h.size = code, lang, fg, size
+		h.spans = codeSpans(code, lang, fg, size)
+	}
+	return h.spans
+}
+
+// parseMarkdown splits md into blocks. It is intentionally small: it covers what gopls, pylsp and
+// typescript-language-server put into hover and documentation, not the full CommonMark spec.
+func parseMarkdown(md string) []*mdBlock {
+	var blocks []*mdBlock
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, &mdBlock{kind: mdParagraph, inlines: parseInline(strings.Join(para, " "))})
+			para = para[:0]
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, &mdBlock{kind: mdCode, lang: lang, code: strings.Join(code, "\n")})
+		case trimmed == "":
+			flush()
+		case trimmed == "---" || trimmed == "***" || trimmed == "___":
+			flush()
+			blocks = append(blocks, &mdBlock{kind: mdRule})
+		case strings.HasPrefix(trimmed, "#"):
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			if level > 6 || !strings.HasPrefix(trimmed[level:], " ") {
+				para = append(para, trimmed)
+				continue
+			}
+			flush()
+			blocks = append(blocks, &mdBlock{kind: mdHeading, level: level, inlines: parseInline(strings.TrimSpace(trimmed[level:]))})
+		default:
+			if marker, rest, ok := listItem(trimmed); ok {
+				flush()
+				blocks = append(blocks, &mdBlock{kind: mdListItem, marker: marker, inlines: parseInline(rest)})
+				continue
+			}
+			para = append(para, trimmed)
+		}
+	}
+	flush()
+	return blocks
+}
+
+// listItem reports whether line starts a bullet or ordered list item.
+func listItem(line string) (marker, rest string, ok bool) {
+	if len(line) > 2 && strings.ContainsRune("-*+", rune(line[0])) && line[1] == ' ' {
+		return "•", line[2:], true
+	}
+	n := 0
+	for n < len(line) && line[n] >= '0' && line[n] <= '9' {
+		n++
+	}
+	if n > 0 && n+1 < len(line) && (line[n] == '.' || line[n] == ')') && line[n+1] == ' ' {
+		return line[:n+1], line[n+2:], true
+	}
+	return "", "", false
+}
+
+// parseInline splits s into styled runs: `code`, **bold**, *italic* / _italic_, [text](url)
+// and backslash escapes.
+func parseInline(s string) []mdInline {
+	var out []mdInline
+	var cur strings.Builder
+	var bold, italic bool
+	emit := func() {
+		if cur.Len() > 0 {
+			out = append(out, mdInline{text: cur.String(), bold: bold, italic: italic})
+			cur.Reset()
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!<>|~", s[i+1]) >= 0:
+			i++
+			cur.WriteByte(s[i])
+		case ch == '`':
+			end := strings.IndexByte(s[i+1:], '`')
+			if end < 0 {
+				cur.WriteByte(ch)
+				continue
+			}
+			emit()
+			out = append(out, mdInline{text: s[i+1 : i+1+end], code: true})
+			i += end + 1
+		case ch == '[':
+			text, url, n := parseLink(s[i:])
+			if n == 0 {
+				cur.WriteByte(ch)
+				continue
+			}
+			emit()
+			out = append(out, mdInline{text: text, url: url, bold: bold, italic: italic})
+			i += n - 1
+		case ch == '*' && i+1 < len(s) && s[i+1] == '*':
+			emit()
+			bold = !bold
+			i++
+		case ch == '*' || (ch == '_' && (i == 0 || !isWordByte(s[i-1]) || i+1 == len(s) || !isWordByte(s[i+1]))):
+			emit()
+			italic = !italic
+		default:
+			cur.WriteByte(ch)
+		}
+	}
+	emit()
+	return out
+}
+
+// parseLink parses "[text](url)" at the start of s and returns the number of bytes consumed (0 if none).
+func parseLink(s string) (text, url string, n int) {
+	closeText := strings.IndexByte(s, ']')
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return "", "", 0
+	}
+	closeURL := strings.IndexByte(s[closeText+2:], ')')
+	if closeURL < 0 {
+		return "", "", 0
+	}
+	text = s[1:closeText]
+	url = s[closeText+2 : closeText+2+closeURL]
+	return text, url, closeText + 2 + closeURL + 1
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
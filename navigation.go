@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"path/filepath"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"github.com/mirzakhany/void/lsp"
+	"go.lsp.dev/protocol"
+)
+
+// navCmdTag is the tag for the F12 navigation commands registered with the editor.
+var navCmdTag struct{}
+
+// navKind selects which LSP navigation request gotoSymbol sends.
+type navKind int
+
+const (
+	navDefinition navKind = iota
+	navDeclaration
+	navTypeDefinition
+	navImplementation
+)
+
+func (k navKind) String() string {
+	switch k {
+	case navDeclaration:
+		return "declaration"
+	case navTypeDefinition:
+		return "type definition"
+	case navImplementation:
+		return "implementation"
+	default:
+		return "definition"
+	}
+}
+
+// method returns the LSP request method for k.
+func (k navKind) method() string {
+	switch k {
+	case navDeclaration:
+		return protocol.MethodTextDocumentDeclaration
+	case navTypeDefinition:
+		return protocol.MethodTextDocumentTypeDefinition
+	case navImplementation:
+		return protocol.MethodTextDocumentImplementation
+	default:
+		return protocol.MethodTextDocumentDefinition
+	}
+}
+
+// navKindForKey maps the modifiers held with F12 to a navigation request:
+// F12 definition, Alt+F12 declaration, Shortcut+F12 implementation, Shortcut+Shift+F12 type definition.
+func navKindForKey(mods key.Modifiers) navKind {
+	switch {
+	case mods.Contain(key.ModShortcut | key.ModShift):
+		return navTypeDefinition
+	case mods.Contain(key.ModShortcut):
+		return navImplementation
+	case mods.Contain(key.ModAlt):
+		return navDeclaration
+	default:
+		return navDefinition
+	}
+}
+
+// gotoSymbol asks the server where the symbol at runeOff in text is defined (or declared, ...)
+// and jumps there; several results open a picker.
+func (s *appState) gotoSymbol(kind navKind, c *lsp.Client, docURI protocol.DocumentURI, text string, runeOff int) {
+	if !c.Supports(kind.method()) {
+		log.Printf("[LSP] server does not support %s", kind.method())
+		return
+	}
+	pos := lsp.RuneOffsetToPosition(text, runeOff)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		var locs []protocol.Location
+		var err error
+		switch kind {
+		case navDeclaration:
+			locs, err = c.Declaration(ctx, docURI, pos.Line, pos.Character)
+		case navTypeDefinition:
+			locs, err = c.TypeDefinition(ctx, docURI, pos.Line, pos.Character)
+		case navImplementation:
+			locs, err = c.Implementation(ctx, docURI, pos.Line, pos.Character)
+		default:
+			locs, err = c.Definition(ctx, docURI, pos.Line, pos.Character)
+		}
+		if err != nil {
+			log.Printf("[LSP] %s failed for %q: %v", kind, docURI, err)
+			return
+		}
+		s.runOnUI(func() {
+			s.showLocations(fmt.Sprintf("Go to %s", kind), locs)
+		})
+	}()
+}
+
+// showLocations jumps to the only location, or lets the user pick one of several.
+func (s *appState) showLocations(title string, locs []protocol.Location) {
+	switch len(locs) {
+	case 0:
+		log.Printf("[LSP] %s: no results", title)
+	case 1:
+		s.openLocation(locs[0])
+	default:
+		items := make([]pickerItem, len(locs))
+		for i, loc := range locs {
+			path := projectPath(lsp.URIToPath(loc.URI))
+			items[i] = pickerItem{
+				Label:  filepath.Base(path),
+				Detail: fmt.Sprintf("%s:%d:%d", path, loc.Range.Start.Line+1, loc.Range.Start.Character+1),
+			}
+		}
+		s.picker.show(title, items, func(i int) {
+			s.openLocation(locs[i])
+		})
+	}
+}
+
+// openLocation opens the file of loc in a tab (or selects it) and selects loc's range.
+func (s *appState) openLocation(loc protocol.Location) {
+	path := projectPath(lsp.URIToPath(loc.URI))
+	s.openFileAsTab(path)
+	fv, ok := s.openFiles[path]
+	if !ok {
+		return
+	}
+	start, end := lsp.RangeToRuneOffsets(fv.Editor.Text(), loc.Range)
+	fv.Editor.SetCaret(start, end)
+	s.focusEditor = true
+}
+
+// ctrlClick detects Ctrl+click (Cmd+click on macOS) over an editor without taking the
+// click away from it, so the editor still moves the caret to the clicked position.
+type ctrlClick struct {
+	_ byte // non-zero size, so every instance is a distinct event tag
+}
+
+// Update reports whether a Ctrl+click happened since the last call.
+func (c *ctrlClick) Update(gtx layout.Context) bool {
+	clicked := false
+	for {
+		ev, ok := gtx.Event(pointer.Filter{Target: c, Kinds: pointer.Press})
+		if !ok {
+			break
+		}
+		if e, ok := ev.(pointer.Event); ok && e.Buttons == pointer.ButtonPrimary && e.Modifiers.Contain(key.ModShortcut) {
+			clicked = true
+		}
+	}
+	return clicked
+}
+
+// Layout registers the pass-through input area; call it after laying out the editor.
+func (c *ctrlClick) Layout(gtx layout.Context, size image.Point) {
+	defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+	defer pointer.PassOp{}.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, c)
+}
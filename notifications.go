@@ -0,0 +1,106 @@
+package main
+
+import (
+	"image"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/chapar-rest/uikit/theme"
+)
+
+// notificationTimeout is how long a notification stays up unless it is clicked away.
+const notificationTimeout = 6 * time.Second
+
+// maxNotifications is how many notifications are shown at once; older ones are dropped.
+const maxNotifications = 4
+
+// notification is a short message shown in the corner of the editor area.
+type notification struct {
+	text    string
+	expires time.Time
+	click   widget.Clickable
+}
+
+// notifications is a stack of transient messages, newest at the bottom.
+type notifications struct {
+	items []*notification
+}
+
+// add shows text until it expires or is clicked.
+func (n *notifications) add(text string) {
+	n.items = append(n.items, &notification{text: text, expires: time.Now().Add(notificationTimeout)})
+	if len(n.items) > maxNotifications {
+		n.items = n.items[len(n.items)-maxNotifications:]
+	}
+}
+
+// notify shows text as a notification. It is safe to call from any goroutine.
+func (s *appState) notify(text string) {
+	s.runOnUI(func() { s.notifications.add(text) })
+}
+
+// Layout draws the notifications stacked in the bottom right corner of the available area.
+func (n *notifications) Layout(gtx layout.Context, th *theme.Theme) layout.Dimensions {
+	now := gtx.Now
+	live := n.items[:0]
+	for _, it := range n.items {
+		if it.click.Clicked(gtx) || !now.Before(it.expires) {
+			continue
+		}
+		live = append(live, it)
+	}
+	n.items = live
+	if len(n.items) == 0 {
+		return layout.Dimensions{}
+	}
+	next := n.items[0].expires
+	for _, it := range n.items[1:] {
+		if it.expires.Before(next) {
+			next = it.expires
+		}
+	}
+	gtx.Execute(op.InvalidateCmd{At: next})
+
+	size := gtx.Constraints.Max
+	layout.SE.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.UniformInset(unit.Dp(12)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min = image.Point{}
+			gtx.Constraints.Max.X = min(gtx.Constraints.Max.X, gtx.Dp(unit.Dp(420)))
+			children := make([]layout.FlexChild, 0, len(n.items))
+			for _, it := range n.items {
+				children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Inset{Top: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+						return it.layout(gtx, th)
+					})
+				}))
+			}
+			return layout.Flex{Axis: layout.Vertical, Alignment: layout.End}.Layout(gtx, children...)
+		})
+	})
+	return layout.Dimensions{Size: size}
+}
+
+func (it *notification) layout(gtx layout.Context, th *theme.Theme) layout.Dimensions {
+	return it.click.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Background{}.Layout(gtx,
+			func(gtx layout.Context) layout.Dimensions {
+				defer clip.UniformRRect(image.Rectangle{Max: gtx.Constraints.Min}, gtx.Dp(unit.Dp(6))).Push(gtx.Ops).Pop()
+				paint.Fill(gtx.Ops, th.Base.SurfaceHighlight)
+				return layout.Dimensions{Size: gtx.Constraints.Min}
+			},
+			func(gtx layout.Context) layout.Dimensions {
+				return layout.Inset{Top: unit.Dp(8), Bottom: unit.Dp(8), Left: unit.Dp(10), Right: unit.Dp(10)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					lb := material.Label(th.Material(), unit.Sp(12), it.text)
+					lb.Color = th.Base.Text
+					return lb.Layout(gtx)
+				})
+			},
+		)
+	})
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+	"unicode"
+
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/mirzakhany/void/lsp"
+	"github.com/oligo/gvcode"
+	gvcolor "github.com/oligo/gvcode/color"
+	"github.com/oligo/gvcode/textstyle/decoration"
+	"go.lsp.dev/protocol"
+)
+
+// occurrencesDelay is how long the caret has to rest before the occurrences of the symbol under
+// it are highlighted.
+const occurrencesDelay = 250 * time.Millisecond
+
+// occurrencesSource is the decoration source of occurrence highlights. It is separate from
+// lsp.DecorationSource so that highlighting occurrences does not clear the diagnostics.
+const occurrencesSource = "occurrences"
+
+// occurrence is a highlighted occurrence: the rune range [start, end) of the document and
+// whether the symbol is written there.
+type occurrence struct {
+	start, end int
+	write      bool
+}
+
+// occurrenceHighlights highlights the occurrences of the symbol under the caret: the server's
+// textDocument/documentHighlight results, with writes told apart from reads, or, when no server
+// can answer, the other whole-word occurrences of the word at the caret.
+type occurrenceHighlights struct {
+	caret int // -1 until the first update
+	shown []occurrence
+	timer *time.Timer
+	// seq is bumped on every caret move or edit so late responses are dropped.
+	seq int
+}
+
+// update follows the caret: the highlights stay while the caret is inside one of them and are
+// cleared otherwise, and the occurrences at the new position are looked up once the caret rests.
+// changed reports whether the text was edited this frame. c may be nil.
+func (o *occurrenceHighlights) update(s *appState, th *theme.Theme, c *lsp.Client, docURI protocol.DocumentURI, ed *gvcode.Editor, changed bool) {
+	line, col := ed.CaretPos()
+	caret, _ := ed.ConvertPos(line, col)
+	if caret == o.caret && !changed {
+		return
+	}
+	o.caret = caret
+	if !changed && o.contains(caret) {
+		return
+	}
+	o.clear(ed)
+	o.seq++
+	seq := o.seq
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	if ed.SelectionLen() > 0 {
+		return
+	}
+	o.timer = time.AfterFunc(occurrencesDelay, func() {
+		s.runOnUI(func() {
+			if seq == o.seq {
+				o.request(s, th, c, docURI, ed)
+			}
+		})
+	})
+}
+
+// request looks up the occurrences of the symbol at the caret, asking the server in the
+// background if it supports documentHighlight.
+func (o *occurrenceHighlights) request(s *appState, th *theme.Theme, c *lsp.Client, docURI protocol.DocumentURI, ed *gvcode.Editor) {
+	text := ed.Text()
+	line, col := ed.CaretPos()
+	caret, _ := ed.ConvertPos(line, col)
+	if c == nil || !c.Supports(protocol.MethodTextDocumentDocumentHighlight) {
+		o.show(th, ed, wordOccurrences([]rune(text), caret))
+		return
+	}
+	seq := o.seq
+	pos := lsp.RuneOffsetToPosition(text, caret)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		result, err := c.DocumentHighlights(ctx, docURI, pos.Line, pos.Character)
+		if err != nil {
+			log.Printf("[LSP] documentHighlight failed for %q: %v", docURI, err)
+			return
+		}
+		positions := make([]protocol.Position, 0, 2*len(result))
+		for _, h := range result {
+			positions = append(positions, h.Range.Start, h.Range.End)
+		}
+		offsets := lsp.RuneOffsets(text, positions)
+		occurrences := make([]occurrence, len(result))
+		for i, h := range result {
+			occurrences[i] = occurrence{
+				start: offsets[2*i],
+				end:   offsets[2*i+1],
+				write: h.Kind == protocol.DocumentHighlightKindWrite,
+			}
+		}
+		s.runOnUI(func() {
+			if seq == o.seq {
+				o.show(th, ed, occurrences)
+			}
+		})
+	}()
+}
+
+// show replaces the highlighted occurrences. Reads and textual occurrences get a background,
+// writes a border too.
+func (o *occurrenceHighlights) show(th *theme.Theme, ed *gvcode.Editor, occurrences []occurrence) {
+	o.clear(ed)
+	if len(occurrences) == 0 {
+		return
+	}
+	background := &decoration.Background{Color: gvcolor.MakeColor(th.Base.Text).MulAlpha(0x28)}
+	border := &decoration.Border{Color: gvcolor.MakeColor(th.Base.Text).MulAlpha(0x70)}
+	decos := make([]decoration.Decoration, 0, len(occurrences))
+	for _, occ := range occurrences {
+		if occ.start >= occ.end {
+			continue
+		}
+		deco := decoration.Decoration{
+			Source:     occurrencesSource,
+			Start:      occ.start,
+			End:        occ.end,
+			Background: background,
+		}
+		if occ.write {
+			deco.Border = border
+		}
+		decos = append(decos, deco)
+	}
+	if err := ed.AddDecorations(decos...); err != nil {
+		log.Printf("[LSP] AddDecorations failed: %v", err)
+	}
+	o.shown = occurrences
+}
+
+// clear removes the highlights.
+func (o *occurrenceHighlights) clear(ed *gvcode.Editor) {
+	if o.shown != nil {
+		ed.ClearDecorations(occurrencesSource)
+		o.shown = nil
+	}
+}
+
+// contains reports whether the rune offset is inside, or at the end of, a highlighted occurrence.
+func (o *occurrenceHighlights) contains(offset int) bool {
+	return slices.ContainsFunc(o.shown, func(occ occurrence) bool {
+		return occ.start <= offset && offset <= occ.end
+	})
+}
+
+// wordOccurrences returns the whole-word occurrences of the identifier at caret in runes, or nil
+// if the caret is not on an identifier or it occurs only once.
+func wordOccurrences(runes []rune, caret int) []occurrence {
+	start, end := wordBounds(runes, caret)
+	if start == end || unicode.IsDigit(runes[start]) {
+		return nil
+	}
+	word := runes[start:end]
+	var occurrences []occurrence
+	for i := 0; i+len(word) <= len(runes); i++ {
+		if i > 0 && isIdentRune(runes[i-1]) || !slices.Equal(runes[i:i+len(word)], word) {
+			continue
+		}
+		if j := i + len(word); j == len(runes) || !isIdentRune(runes[j]) {
+			occurrences = append(occurrences, occurrence{start: i, end: j})
+			i = j - 1
+		}
+	}
+	if len(occurrences) < 2 {
+		return nil
+	}
+	return occurrences
+}
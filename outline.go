@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"image"
+	"image/color"
+	"log"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/chapar-rest/uikit/treeview"
+	"github.com/mirzakhany/void/lsp"
+	"github.com/oligo/gvcode"
+	"go.lsp.dev/protocol"
+	mdicons "golang.org/x/exp/shiny/materialdesign/icons"
+)
+
+// outlineDelay is how long the outline waits after an edit before it is rebuilt.
+const outlineDelay = 500 * time.Millisecond
+
+// outlineIcon is the Outline sidebar item's icon; the others are the icons of symbol kinds.
+var (
+	outlineIcon         = newIcon(mdicons.ActionTOC)
+	functionSymbolIcon  = newIcon(mdicons.EditorFunctions)
+	typeSymbolIcon      = newIcon(mdicons.ActionClass)
+	interfaceSymbolIcon = newIcon(mdicons.ActionExtension)
+	fieldSymbolIcon     = newIcon(mdicons.ActionLabelOutline)
+	variableSymbolIcon  = newIcon(mdicons.EditorShortText)
+	constantSymbolIcon  = newIcon(mdicons.ImageLooksOne)
+	enumSymbolIcon      = newIcon(mdicons.EditorFormatListBulleted)
+	typeParamSymbolIcon = newIcon(mdicons.EditorTextFields)
+	moduleSymbolIcon    = newIcon(mdicons.FileFolder)
+	otherSymbolIcon     = newIcon(mdicons.ImageLens)
+)
+
+// newIcon returns the material design icon encoded in data.
+func newIcon(data []byte) *widget.Icon {
+	icon, _ := widget.NewIcon(data)
+	return icon
+}
+
+// outlineSymbol is a symbol of the outline, with its ranges as rune offsets into the text the
+// outline was built from.
+type outlineSymbol struct {
+	id   string // ID of its tree node
+	name string
+	kind protocol.SymbolKind
+	// start and end span the whole symbol (e.g. a function with its body); selStart and selEnd
+	// the part selected when jumping to it (e.g. its name).
+	start, end       int
+	selStart, selEnd int
+	children         []*outlineSymbol
+	click            widget.Clickable
+}
+
+// outlinePanel is the Outline view of the sidebar: a tree of the current file's symbols from
+// textDocument/documentSymbol, or from go/parser for Go files without a language server. The
+// symbols around the caret are highlighted, and clicking a symbol jumps to it.
+type outlinePanel struct {
+	tree    *treeview.Tree
+	nodes   map[string]*treeview.Node // by ID, reused on rebuilds so expanded nodes stay expanded
+	symbols []*outlineSymbol
+	// active are the symbols containing the caret, innermost last.
+	active []*outlineSymbol
+	path   string // file the outline is for
+	text   string // text of that file the outline was last requested for
+	timer  *time.Timer
+	// seq is bumped on every request so late responses are dropped.
+	seq int
+}
+
+// layoutOutline lays out the outline of the current file.
+func (s *appState) layoutOutline(gtx layout.Context) layout.Dimensions {
+	o := &s.outline
+	if s.tabitems.CurrentView() < 0 || s.tabitems.CurrentView() >= len(s.openPaths) {
+		return layoutOutlineMessage(gtx, s.theme, "No file open")
+	}
+	fv, ok := s.openFiles[s.openPaths[s.tabitems.CurrentView()]]
+	if !ok {
+		return layoutOutlineMessage(gtx, s.theme, "No file open")
+	}
+	o.update(s, fv)
+	if len(o.symbols) == 0 {
+		return layoutOutlineMessage(gtx, s.theme, "No symbols")
+	}
+	o.syncCaret(fv.Editor)
+	return o.tree.Layout(gtx, s.theme)
+}
+
+func layoutOutlineMessage(gtx layout.Context, th *theme.Theme, msg string) layout.Dimensions {
+	return layout.UniformInset(unit.Dp(12)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		lb := material.Label(th.Material(), unit.Sp(13), msg)
+		lb.Color = th.Base.TextSubtle
+		return lb.Layout(gtx)
+	})
+}
+
+// update keeps the outline in step with fv: a newly shown file is outlined right away, an edited
+// one once typing pauses.
+func (o *outlinePanel) update(s *appState, fv *fileView) {
+	text := fv.Editor.Text()
+	switch {
+	case fv.Path != o.path:
+		o.path, o.text = fv.Path, text
+		o.set(s, nil)
+		o.request(s, fv, text)
+	case text != o.text:
+		o.text = text
+		o.seq++
+		seq := o.seq
+		if o.timer != nil {
+			o.timer.Stop()
+		}
+		o.timer = time.AfterFunc(outlineDelay, func() {
+			s.runOnUI(func() {
+				if seq == o.seq {
+					o.request(s, fv, fv.Editor.Text())
+				}
+			})
+		})
+	}
+}
+
+// request builds the outline of fv's text in the background, from the language server's
+// document symbols or, for Go files without one, from go/parser.
+func (o *outlinePanel) request(s *appState, fv *fileView, text string) {
+	o.seq++
+	seq := o.seq
+	c, docURI, path := fv.LSPClient, protocol.DocumentURI(fv.LSPDocURI), fv.Path
+	go func() {
+		var symbols []*outlineSymbol
+		switch {
+		case c != nil && c.Supports(protocol.MethodTextDocumentDocumentSymbol):
+			ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+			defer cancel()
+			result, err := c.DocumentSymbols(ctx, docURI)
+			if err != nil {
+				log.Printf("[LSP] documentSymbol failed for %q: %v", docURI, err)
+				return
+			}
+			symbols = outlineFromLSP(text, result)
+		case lspLanguageID(path) == "go":
+			symbols = goOutline(path, text)
+		}
+		s.runOnUI(func() {
+			if seq == o.seq {
+				o.set(s, symbols)
+			}
+		})
+	}()
+}
+
+// set replaces the outline's symbols and rebuilds the tree from them.
+func (o *outlinePanel) set(s *appState, symbols []*outlineSymbol) {
+	if o.tree == nil {
+		o.tree = treeview.NewTree()
+	}
+	for _, sym := range o.symbols {
+		o.tree.Remove(sym.id)
+	}
+	nodes := make(map[string]*treeview.Node)
+	for _, node := range o.buildNodes(s, symbols, "", nodes) {
+		o.tree.Insert(node)
+	}
+	o.nodes = nodes
+	o.symbols = symbols
+	o.active = nil
+}
+
+// buildNodes returns the tree nodes of symbols, whose parent node has the ID parentID, and adds
+// them and their descendants to nodes.
+func (o *outlinePanel) buildNodes(s *appState, symbols []*outlineSymbol, parentID string, nodes map[string]*treeview.Node) []*treeview.Node {
+	built := make([]*treeview.Node, 0, len(symbols))
+	for _, sym := range symbols {
+		sym.id = fmt.Sprintf("%s/%v %s", parentID, sym.kind, sym.name)
+		for i := 2; nodes[sym.id] != nil; i++ { // e.g. several init functions
+			sym.id = fmt.Sprintf("%s/%v %s#%d", parentID, sym.kind, sym.name, i)
+		}
+		node := o.nodes[sym.id]
+		if node == nil {
+			node = treeview.NewNode(sym.id, nil)
+		}
+		node.Widget = o.symbolWidget(s, sym)
+		node.Children = nil
+		nodes[sym.id] = node
+		for _, child := range o.buildNodes(s, sym.children, sym.id, nodes) {
+			node.AddChild(child)
+		}
+		built = append(built, node)
+	}
+	return built
+}
+
+// symbolWidget returns the widget of sym's tree node: its kind's icon, its name and its kind.
+func (o *outlinePanel) symbolWidget(s *appState, sym *outlineSymbol) treeview.NodeWidget {
+	return func(gtx layout.Context, th *theme.Theme) layout.Dimensions {
+		if sym.click.Clicked(gtx) {
+			s.gotoOutlineSymbol(sym)
+		}
+		_, _, txt := th.FgBgTxt(theme.KindPrimary, treeview.TreeComponent)
+		icon, iconColor := symbolKindIcon(th, sym.kind)
+		content := func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Left: unit.Dp(4), Right: unit.Dp(4), Top: unit.Dp(1), Bottom: unit.Dp(1)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						size := gtx.Dp(unit.Dp(16))
+						gtx.Constraints = layout.Exact(image.Pt(size, size))
+						return icon.Layout(gtx, iconColor)
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						return layout.Inset{Left: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							lb := material.Label(th.Material(), unit.Sp(14), sym.name)
+							lb.Color = txt
+							lb.MaxLines = 1
+							return lb.Layout(gtx)
+						})
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						return layout.Inset{Left: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							lb := material.Label(th.Material(), unit.Sp(12), symbolKindName(sym.kind))
+							lb.Color = th.Base.TextSubtle
+							lb.MaxLines = 1
+							return lb.Layout(gtx)
+						})
+					}),
+				)
+			})
+		}
+		return sym.click.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			if !slices.Contains(o.active, sym) {
+				return content(gtx)
+			}
+			return layout.Background{}.Layout(gtx,
+				func(gtx layout.Context) layout.Dimensions {
+					defer clip.UniformRRect(image.Rectangle{Max: gtx.Constraints.Min}, gtx.Dp(unit.Dp(3))).Push(gtx.Ops).Pop()
+					paint.Fill(gtx.Ops, th.Base.SurfaceHighlight)
+					return layout.Dimensions{Size: gtx.Constraints.Min}
+				},
+				content,
+			)
+		})
+	}
+}
+
+// syncCaret marks the symbols containing the caret of ed as active.
+func (o *outlinePanel) syncCaret(ed *gvcode.Editor) {
+	line, col := ed.CaretPos()
+	off, _ := ed.ConvertPos(line, col)
+	o.active = o.active[:0]
+	symbols := o.symbols
+	for {
+		i := slices.IndexFunc(symbols, func(sym *outlineSymbol) bool { return sym.start <= off && off <= sym.end })
+		if i < 0 {
+			return
+		}
+		o.active = append(o.active, symbols[i])
+		symbols = symbols[i].children
+	}
+}
+
+// gotoOutlineSymbol selects sym in the editor of the outlined file and focuses it.
+func (s *appState) gotoOutlineSymbol(sym *outlineSymbol) {
+	fv, ok := s.openFiles[s.outline.path]
+	if !ok {
+		return
+	}
+	n := utf8.RuneCountInString(fv.Editor.Text())
+	fv.Editor.SetCaret(min(sym.selStart, n), min(sym.selEnd, n))
+	s.focusEditor = true
+}
+
+// symbolKindIcon returns the icon of a symbol kind and the color to draw it in.
+func symbolKindIcon(th *theme.Theme, kind protocol.SymbolKind) (*widget.Icon, color.NRGBA) {
+	switch kind {
+	case protocol.SymbolKindFunction, protocol.SymbolKindMethod, protocol.SymbolKindConstructor, protocol.SymbolKindOperator:
+		return functionSymbolIcon, th.Base.Primary
+	case protocol.SymbolKindClass, protocol.SymbolKindStruct, protocol.SymbolKindObject:
+		return typeSymbolIcon, th.Base.Warning
+	case protocol.SymbolKindInterface:
+		return interfaceSymbolIcon, th.Base.Info
+	case protocol.SymbolKindField, protocol.SymbolKindProperty, protocol.SymbolKindKey:
+		return fieldSymbolIcon, th.Base.Secondary
+	case protocol.SymbolKindVariable, protocol.SymbolKindArray, protocol.SymbolKindString,
+		protocol.SymbolKindNumber, protocol.SymbolKindBoolean, protocol.SymbolKindNull:
+		return variableSymbolIcon, th.Base.Info
+	case protocol.SymbolKindConstant, protocol.SymbolKindEnumMember:
+		return constantSymbolIcon, th.Base.Notice
+	case protocol.SymbolKindEnum:
+		return enumSymbolIcon, th.Base.Warning
+	case protocol.SymbolKindTypeParameter:
+		return typeParamSymbolIcon, th.Base.Success
+	case protocol.SymbolKindFile, protocol.SymbolKindModule, protocol.SymbolKindNamespace, protocol.SymbolKindPackage:
+		return moduleSymbolIcon, th.Base.TextSubtle
+	default:
+		return otherSymbolIcon, th.Base.TextSubtle
+	}
+}
+
+// symbolKindName returns the name shown for a symbol kind, e.g. "Method".
+func symbolKindName(kind protocol.SymbolKind) string {
+	if kind < protocol.SymbolKindFile || kind > protocol.SymbolKindTypeParameter {
+		return ""
+	}
+	return kind.String()
+}
+
+// outlineFromLSP converts document symbols the server computed for text to outline symbols.
+func outlineFromLSP(text string, symbols []protocol.DocumentSymbol) []*outlineSymbol {
+	var positions []protocol.Position
+	var collect func(symbols []protocol.DocumentSymbol)
+	collect = func(symbols []protocol.DocumentSymbol) {
+		for _, sym := range symbols {
+			positions = append(positions, sym.Range.Start, sym.Range.End, sym.SelectionRange.Start, sym.SelectionRange.End)
+			collect(sym.Children)
+		}
+	}
+	collect(symbols)
+	offsets := lsp.RuneOffsets(text, positions)
+	var build func(symbols []protocol.DocumentSymbol) []*outlineSymbol
+	build = func(symbols []protocol.DocumentSymbol) []*outlineSymbol {
+		built := make([]*outlineSymbol, len(symbols))
+		for i, sym := range symbols {
+			built[i] = &outlineSymbol{
+				name:     sym.Name,
+				kind:     sym.Kind,
+				start:    offsets[0],
+				end:      offsets[1],
+				selStart: offsets[2],
+				selEnd:   offsets[3],
+			}
+			offsets = offsets[4:]
+			built[i].children = build(sym.Children)
+		}
+		return built
+	}
+	return build(symbols)
+}
+
+// goOutline builds the outline of a Go file with go/parser: its functions, methods, types with
+// their fields or methods, constants and variables. A file with syntax errors is outlined as far
+// as the parser got.
+func goOutline(path, text string) []*outlineSymbol {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, path, text, parser.SkipObjectResolution)
+	if f == nil {
+		return nil
+	}
+	b := &goOutlineBuilder{file: fset.File(f.Pos())}
+	var symbols []*outlineSymbol
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			kind, name := protocol.SymbolKindFunction, d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				kind, name = protocol.SymbolKindMethod, "("+types.ExprString(d.Recv.List[0].Type)+")."+name
+			}
+			symbols = append(symbols, b.symbol(name, kind, d, d.Name))
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				// A declaration of a single spec spans its keyword too.
+				var node ast.Node = spec
+				if !d.Lparen.IsValid() {
+					node = d
+				}
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					sym := b.symbol(sp.Name.Name, goTypeKind(sp.Type), node, sp.Name)
+					sym.children = b.members(sp.Type)
+					symbols = append(symbols, sym)
+				case *ast.ValueSpec:
+					kind := protocol.SymbolKindVariable
+					if d.Tok == token.CONST {
+						kind = protocol.SymbolKindConstant
+					}
+					for _, n := range sp.Names {
+						if n.Name != "_" {
+							symbols = append(symbols, b.symbol(n.Name, kind, node, n))
+						}
+					}
+				}
+			}
+		}
+	}
+	toRuneOffsets(text, b.offsets)
+	return symbols
+}
+
+// goOutlineBuilder creates the outline symbols of a Go file. Their offsets are byte offsets until
+// goOutline converts them.
+type goOutlineBuilder struct {
+	file    *token.File
+	offsets []*int // the offsets of all symbols created
+}
+
+// symbol returns a symbol spanning node, which selects sel when jumped to.
+func (b *goOutlineBuilder) symbol(name string, kind protocol.SymbolKind, node, sel ast.Node) *outlineSymbol {
+	sym := &outlineSymbol{
+		name:     name,
+		kind:     kind,
+		start:    b.file.Offset(node.Pos()),
+		end:      b.file.Offset(node.End()),
+		selStart: b.file.Offset(sel.Pos()),
+		selEnd:   b.file.Offset(sel.End()),
+	}
+	b.offsets = append(b.offsets, &sym.start, &sym.end, &sym.selStart, &sym.selEnd)
+	return sym
+}
+
+// members returns the fields of a struct type or the methods and embedded interfaces of an
+// interface type.
+func (b *goOutlineBuilder) members(typ ast.Expr) []*outlineSymbol {
+	var fields *ast.FieldList
+	kind := protocol.SymbolKindField
+	switch t := typ.(type) {
+	case *ast.StructType:
+		fields = t.Fields
+	case *ast.InterfaceType:
+		fields, kind = t.Methods, protocol.SymbolKindMethod
+	default:
+		return nil
+	}
+	var members []*outlineSymbol
+	for _, field := range fields.List {
+		if len(field.Names) == 0 { // embedded
+			embeddedKind := kind
+			if kind == protocol.SymbolKindMethod {
+				embeddedKind = protocol.SymbolKindInterface
+			}
+			members = append(members, b.symbol(types.ExprString(field.Type), embeddedKind, field, field.Type))
+			continue
+		}
+		for _, n := range field.Names {
+			sym := b.symbol(n.Name, kind, field, n)
+			if kind == protocol.SymbolKindField {
+				sym.children = b.members(field.Type)
+			}
+			members = append(members, sym)
+		}
+	}
+	return members
+}
+
+// goTypeKind returns the symbol kind of a Go type declaration.
+func goTypeKind(typ ast.Expr) protocol.SymbolKind {
+	switch typ.(type) {
+	case *ast.StructType:
+		return protocol.SymbolKindStruct
+	case *ast.InterfaceType:
+		return protocol.SymbolKindInterface
+	default:
+		return protocol.SymbolKindClass
+	}
+}
+
+// toRuneOffsets converts the byte offsets into text that offsets point to into rune offsets.
+func toRuneOffsets(text string, offsets []*int) {
+	slices.SortFunc(offsets, func(a, b *int) int { return *a - *b })
+	runes, pos := 0, 0
+	for _, off := range offsets {
+		end := min(*off, len(text))
+		runes += utf8.RuneCountInString(text[pos:end])
+		pos = end
+		*off = runes
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"image"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/chapar-rest/uikit/theme"
+)
+
+// pickerItem is one entry in a picker.
+type pickerItem struct {
+	Label  string
+	Detail string // secondary text, e.g. file:line
+}
+
+// picker is a modal list shown over the editor area (e.g. to choose between several definitions).
+// Up/Down move the selection, Enter or a click picks an entry, Escape or a click outside closes it.
+type picker struct {
+	visible  bool
+	title    string
+	items    []pickerItem
+	clicks   []widget.Clickable
+	selected int
+	onPick   func(i int)
+	list     widget.List
+	scrim    widget.Clickable
+	// focus is set when the picker opens so Layout grabs keyboard focus.
+	focus bool
+	// closed is set when the picker closes so the caller can hand focus back to the editor.
+	closed bool
+}
+
+// show opens the picker with items; onPick is called with the chosen index.
+func (p *picker) show(title string, items []pickerItem, onPick func(i int)) {
+	p.visible = true
+	p.title = title
+	p.items = items
+	p.clicks = make([]widget.Clickable, len(items))
+	p.selected = 0
+	p.onPick = onPick
+	p.list.Position = layout.Position{}
+	p.focus = true
+}
+
+// hide closes the picker without picking anything.
+func (p *picker) hide() {
+	p.visible = false
+	p.items = nil
+	p.clicks = nil
+	p.onPick = nil
+	p.closed = true
+}
+
+// pick closes the picker and calls onPick with i.
+func (p *picker) pick(i int) {
+	onPick := p.onPick
+	p.hide()
+	if onPick != nil && i >= 0 && i < len(p.items) {
+		onPick(i)
+	}
+}
+
+// update handles keyboard and click events.
+func (p *picker) update(gtx layout.Context) {
+	for {
+		ev, ok := gtx.Event(
+			key.Filter{Focus: p, Name: key.NameUpArrow},
+			key.Filter{Focus: p, Name: key.NameDownArrow},
+			key.Filter{Focus: p, Name: key.NameEnter},
+			key.Filter{Focus: p, Name: key.NameReturn},
+			key.Filter{Focus: p, Name: key.NameEscape},
+		)
+		if !ok {
+			break
+		}
+		e, ok := ev.(key.Event)
+		if !ok || e.State != key.Press {
+			continue
+		}
+		switch e.Name {
+		case key.NameUpArrow:
+			p.selected = max(p.selected-1, 0)
+			p.list.ScrollTo(p.selected)
+		case key.NameDownArrow:
+			p.selected = min(p.selected+1, len(p.items)-1)
+			p.list.ScrollTo(p.selected)
+		case key.NameEnter, key.NameReturn:
+			p.pick(p.selected)
+			return
+		case key.NameEscape:
+			p.hide()
+			return
+		}
+	}
+	for i := range p.clicks {
+		if p.clicks[i].Clicked(gtx) {
+			p.pick(i)
+			return
+		}
+	}
+	if p.scrim.Clicked(gtx) {
+		p.hide()
+	}
+}
+
+// Layout draws the picker centered at the top of the available area.
+func (p *picker) Layout(gtx layout.Context, th *theme.Theme) layout.Dimensions {
+	if !p.visible {
+		return layout.Dimensions{}
+	}
+	p.update(gtx)
+	if !p.visible {
+		return layout.Dimensions{}
+	}
+	if p.focus {
+		gtx.Execute(key.FocusCmd{Tag: p})
+		p.focus = false
+	}
+
+	size := gtx.Constraints.Max
+	p.scrim.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Dimensions{Size: size}
+	})
+
+	layoutModal(gtx, th, p, unit.Dp(560), func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Inset{Left: unit.Dp(6), Bottom: unit.Dp(6), Top: unit.Dp(2)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					lb := material.Label(th.Material(), unit.Sp(12), p.title)
+					lb.Color = th.Base.TextSubtle
+					return lb.Layout(gtx)
+				})
+			}),
+			layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+				p.list.Axis = layout.Vertical
+				return material.List(th.Material(), &p.list).Layout(gtx, len(p.items), func(gtx layout.Context, i int) layout.Dimensions {
+					return p.layoutItem(gtx, th, i)
+				})
+			}),
+		)
+	})
+	return layout.Dimensions{Size: size}
+}
+
+// layoutModal draws w in a rounded box of at most width, centered at the top of the available
+// area. The box is an input area for tag, so it can take keyboard focus and blocks clicks to
+// whatever is beneath it.
+func layoutModal(gtx layout.Context, th *theme.Theme, tag event.Tag, width unit.Dp, w layout.Widget) layout.Dimensions {
+	return layout.N.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Inset{Top: unit.Dp(24)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min = image.Point{}
+			gtx.Constraints.Max.X = min(gtx.Constraints.Max.X, gtx.Dp(width))
+			gtx.Constraints.Max.Y = min(gtx.Constraints.Max.Y, gtx.Dp(unit.Dp(360)))
+			gtx.Constraints.Min.X = gtx.Constraints.Max.X
+			return layout.Background{}.Layout(gtx,
+				func(gtx layout.Context) layout.Dimensions {
+					defer clip.UniformRRect(image.Rectangle{Max: gtx.Constraints.Min}, gtx.Dp(unit.Dp(6))).Push(gtx.Ops).Pop()
+					event.Op(gtx.Ops, tag)
+					paint.Fill(gtx.Ops, th.Base.SurfaceHighlight)
+					return layout.Dimensions{Size: gtx.Constraints.Min}
+				},
+				func(gtx layout.Context) layout.Dimensions {
+					return layout.UniformInset(unit.Dp(6)).Layout(gtx, w)
+				},
+			)
+		})
+	})
+}
+
+func (p *picker) layoutItem(gtx layout.Context, th *theme.Theme, i int) layout.Dimensions {
+	item := p.items[i]
+	return p.clicks[i].Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Background{}.Layout(gtx,
+			func(gtx layout.Context) layout.Dimensions {
+				if i == p.selected || p.clicks[i].Hovered() {
+					defer clip.UniformRRect(image.Rectangle{Max: gtx.Constraints.Min}, gtx.Dp(unit.Dp(4))).Push(gtx.Ops).Pop()
+					paint.Fill(gtx.Ops, th.Base.Surface)
+				}
+				return layout.Dimensions{Size: gtx.Constraints.Min}
+			},
+			func(gtx layout.Context) layout.Dimensions {
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return layout.Inset{Top: unit.Dp(4), Bottom: unit.Dp(4), Left: unit.Dp(6), Right: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Baseline}.Layout(gtx,
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							lb := material.Label(th.Material(), unit.Sp(13), item.Label)
+							lb.Color = th.Base.Text
+							lb.MaxLines = 1
+							return lb.Layout(gtx)
+						}),
+						layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+							if item.Detail == "" {
+								return layout.Dimensions{}
+							}
+							return layout.Inset{Left: unit.Dp(10)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+								lb := material.Label(th.Material(), unit.Sp(11), item.Detail)
+								lb.Color = th.Base.TextSubtle
+								lb.MaxLines = 1
+								return lb.Layout(gtx)
+							})
+						}),
+					)
+				})
+			},
+		)
+	})
+}
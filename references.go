@@ -0,0 +1,343 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"gioui.org/x/richtext"
+	"github.com/chapar-rest/uikit/button"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/mirzakhany/void/lsp"
+	"go.lsp.dev/protocol"
+)
+
+// maxPreviewRunes caps the length of a line preview in the references panel.
+const maxPreviewRunes = 160
+
+// refHit is one reference listed in the references panel.
+type refHit struct {
+	loc     protocol.Location
+	preview []rune // the referencing line, leading whitespace trimmed
+	// start, end is the referenced span within preview (rune offsets).
+	start, end int
+	click      widget.Clickable
+}
+
+// refGroup holds the references found in one file.
+type refGroup struct {
+	path string
+	hits []*refHit
+}
+
+// referencesPanel is the bottom "References" panel: textDocument/references results grouped by file.
+type referencesPanel struct {
+	visible bool
+	symbol  string
+	groups  []*refGroup
+	count   int
+	current *refHit // last opened hit, highlighted in the list
+	list    widget.List
+	close   widget.Clickable
+}
+
+// findReferences asks the server for all references to the symbol at runeOff in text and shows them
+// in the references panel.
+func (s *appState) findReferences(c *lsp.Client, docURI protocol.DocumentURI, text string, runeOff int) {
+	if !c.Supports(protocol.MethodTextDocumentReferences) {
+		log.Printf("[LSP] server does not support %s", protocol.MethodTextDocumentReferences)
+		return
+	}
+	pos := lsp.RuneOffsetToPosition(text, runeOff)
+	symbol := wordAt([]rune(text), runeOff)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		locs, err := c.References(ctx, docURI, pos.Line, pos.Character, true)
+		if err != nil {
+			log.Printf("[LSP] references failed for %q: %v", docURI, err)
+			return
+		}
+		s.runOnUI(func() {
+			s.references.set(symbol, s.referenceGroups(locs))
+		})
+	}()
+}
+
+// referenceGroups groups locs by file (sorted by path, then position) and builds the line previews,
+// reading open files from their editor and others from disk.
+func (s *appState) referenceGroups(locs []protocol.Location) []*refGroup {
+	slices.SortStableFunc(locs, func(a, b protocol.Location) int {
+		return cmp.Or(
+			cmp.Compare(projectPath(lsp.URIToPath(a.URI)), projectPath(lsp.URIToPath(b.URI))),
+			cmp.Compare(a.Range.Start.Line, b.Range.Start.Line),
+			cmp.Compare(a.Range.Start.Character, b.Range.Start.Character),
+		)
+	})
+	var groups []*refGroup
+	var text string
+	var runes []rune
+	for _, loc := range locs {
+		path := projectPath(lsp.URIToPath(loc.URI))
+		if len(groups) == 0 || groups[len(groups)-1].path != path {
+			groups = append(groups, &refGroup{path: path})
+			if fv, ok := s.openFiles[path]; ok {
+				text = fv.Editor.Text()
+			} else if data, err := os.ReadFile(path); err == nil {
+				text = string(data)
+			} else {
+				text = ""
+			}
+			runes = []rune(text)
+		}
+		g := groups[len(groups)-1]
+		g.hits = append(g.hits, newRefHit(loc, text, runes))
+	}
+	return groups
+}
+
+// newRefHit builds the preview of the line loc starts on, with the referenced span located through
+// lsp.RangeToRuneOffsets.
+func newRefHit(loc protocol.Location, text string, runes []rune) *refHit {
+	hit := &refHit{loc: loc}
+	start, end := lsp.RangeToRuneOffsets(text, loc.Range)
+	lineStart := lsp.PositionToRuneOffset(text, loc.Range.Start.Line, 0)
+	lineEnd := lineStart
+	for lineEnd < len(runes) && runes[lineEnd] != '\n' {
+		lineEnd++
+	}
+	line := runes[lineStart:lineEnd]
+	start, end = start-lineStart, min(end, lineEnd)-lineStart
+	indent := 0
+	for indent < len(line) && indent < start && unicode.IsSpace(line[indent]) {
+		indent++
+	}
+	line, start, end = line[indent:], start-indent, end-indent
+	if len(line) > maxPreviewRunes {
+		// Keep the match visible in very long lines.
+		from := max(0, min(start-maxPreviewRunes/4, len(line)-maxPreviewRunes))
+		line, start, end = line[from:from+maxPreviewRunes], start-from, end-from
+	}
+	hit.preview = line
+	hit.start = max(0, min(start, len(line)))
+	hit.end = max(hit.start, min(end, len(line)))
+	return hit
+}
+
+// wordAt returns the identifier around runeOff.
+func wordAt(runes []rune, runeOff int) string {
+	start, end := wordBounds(runes, runeOff)
+	return string(runes[start:end])
+}
+
+// wordBounds returns the rune range [start, end) of the identifier around runeOff; start == end
+// if there is none.
+func wordBounds(runes []rune, runeOff int) (start, end int) {
+	runeOff = max(0, min(runeOff, len(runes)))
+	start, end = runeOff, runeOff
+	for start > 0 && isIdentRune(runes[start-1]) {
+		start--
+	}
+	for end < len(runes) && isIdentRune(runes[end]) {
+		end++
+	}
+	return start, end
+}
+
+// isIdentRune reports whether r can be part of an identifier.
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// set shows groups in the panel.
+func (p *referencesPanel) set(symbol string, groups []*refGroup) {
+	p.visible = true
+	p.symbol = symbol
+	p.groups = groups
+	p.count = 0
+	for _, g := range groups {
+		p.count += len(g.hits)
+	}
+	p.current = nil
+	p.list.Position = layout.Position{}
+}
+
+// clicked returns the location of a clicked entry, if any.
+func (p *referencesPanel) clicked(gtx layout.Context) (protocol.Location, bool) {
+	for _, g := range p.groups {
+		for _, hit := range g.hits {
+			if hit.click.Clicked(gtx) {
+				p.current = hit
+				return hit.loc, true
+			}
+		}
+	}
+	return protocol.Location{}, false
+}
+
+// Layout draws the panel: a title bar with a close button and the grouped hits.
+func (p *referencesPanel) Layout(gtx layout.Context, th *theme.Theme) layout.Dimensions {
+	if p.close.Clicked(gtx) {
+		p.visible = false
+		p.groups = nil
+		p.current = nil
+	}
+	if !p.visible {
+		return layout.Dimensions{}
+	}
+	height := min(gtx.Constraints.Max.Y/3, gtx.Dp(unit.Dp(260)))
+	gtx.Constraints.Min.Y, gtx.Constraints.Max.Y = height, height
+	gtx.Constraints.Min.X = gtx.Constraints.Max.X
+	paint.FillShape(gtx.Ops, th.Base.Surface, clip.Rect{Max: gtx.Constraints.Max}.Op())
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Left: unit.Dp(8), Right: unit.Dp(8), Top: unit.Dp(4), Bottom: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						lb := material.Label(th.Material(), unit.Sp(13), "References")
+						lb.Font.Weight = font.Bold
+						lb.Color = th.Base.Text
+						return lb.Layout(gtx)
+					}),
+					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+						return layout.Inset{Left: unit.Dp(10)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							summary := fmt.Sprintf("%d results in %d files", p.count, len(p.groups))
+							if p.symbol != "" {
+								summary = fmt.Sprintf("%s: %s", p.symbol, summary)
+							}
+							lb := material.Label(th.Material(), unit.Sp(12), summary)
+							lb.Color = th.Base.TextSubtle
+							lb.MaxLines = 1
+							return lb.Layout(gtx)
+						})
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						return button.TextButton(th, &p.close, "Close", theme.KindPrimary).Layout(gtx, th)
+					}),
+				)
+			})
+		}),
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			p.list.Axis = layout.Vertical
+			rows := p.rows()
+			return material.List(th.Material(), &p.list).Layout(gtx, len(rows), func(gtx layout.Context, i int) layout.Dimensions {
+				if rows[i].hit == nil {
+					return layoutRefGroupHeader(gtx, th, rows[i].group)
+				}
+				return p.layoutHit(gtx, th, rows[i].hit)
+			})
+		}),
+	)
+}
+
+// refRow is a list row: a file header (hit == nil) or a hit.
+type refRow struct {
+	group *refGroup
+	hit   *refHit
+}
+
+func (p *referencesPanel) rows() []refRow {
+	rows := make([]refRow, 0, p.count+len(p.groups))
+	for _, g := range p.groups {
+		rows = append(rows, refRow{group: g})
+		for _, hit := range g.hits {
+			rows = append(rows, refRow{group: g, hit: hit})
+		}
+	}
+	return rows
+}
+
+func layoutRefGroupHeader(gtx layout.Context, th *theme.Theme, g *refGroup) layout.Dimensions {
+	return layout.Inset{Left: unit.Dp(8), Top: unit.Dp(4), Bottom: unit.Dp(2)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Baseline}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				lb := material.Label(th.Material(), unit.Sp(12), g.path)
+				lb.Color = th.Base.Text
+				return lb.Layout(gtx)
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Inset{Left: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					lb := material.Label(th.Material(), unit.Sp(11), fmt.Sprintf("%d", len(g.hits)))
+					lb.Color = th.Base.TextSubtle
+					return lb.Layout(gtx)
+				})
+			}),
+		)
+	})
+}
+
+func (p *referencesPanel) layoutHit(gtx layout.Context, th *theme.Theme, hit *refHit) layout.Dimensions {
+	return hit.click.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Background{}.Layout(gtx,
+			func(gtx layout.Context) layout.Dimensions {
+				if hit == p.current || hit.click.Hovered() {
+					paint.FillShape(gtx.Ops, th.Base.SurfaceHighlight, clip.Rect{Max: gtx.Constraints.Min}.Op())
+				}
+				return layout.Dimensions{Size: gtx.Constraints.Min}
+			},
+			func(gtx layout.Context) layout.Dimensions {
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return layout.Inset{Left: unit.Dp(24), Right: unit.Dp(8), Top: unit.Dp(2), Bottom: unit.Dp(2)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Baseline}.Layout(gtx,
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							gtx.Constraints.Min.X = gtx.Dp(unit.Dp(40))
+							lb := material.Label(th.Material(), unit.Sp(11), fmt.Sprintf("%d", hit.loc.Range.Start.Line+1))
+							lb.Color = th.Base.TextSubtle
+							return lb.Layout(gtx)
+						}),
+						layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+							return richtext.Text(nil, th.Material().Shaper, previewSpans(th, hit)...).Layout(gtx)
+						}),
+					)
+				})
+			},
+		)
+	})
+}
+
+// previewSpans styles hit's preview line with the referenced span emphasized.
+func previewSpans(th *theme.Theme, hit *refHit) []richtext.SpanStyle {
+	size := unit.Sp(12)
+	parts := []struct {
+		text  string
+		match bool
+	}{
+		{string(hit.preview[:hit.start]), false},
+		{string(hit.preview[hit.start:hit.end]), true},
+		{string(hit.preview[hit.end:]), false},
+	}
+	spans := make([]richtext.SpanStyle, 0, len(parts))
+	for _, part := range parts {
+		if part.text == "" {
+			continue
+		}
+		ss := richtext.SpanStyle{Font: EditorFont(), Size: size, Color: th.Base.TextSubtle, Content: strings.ReplaceAll(part.text, "\t", "    ")}
+		if part.match {
+			ss.Font.Weight = font.Bold
+			ss.Color = th.Base.Primary
+		}
+		spans = append(spans, ss)
+	}
+	return spans
+}
+
+// layoutReferences draws the references panel below the editor and opens clicked entries.
+func (s *appState) layoutReferences(gtx layout.Context) layout.Dimensions {
+	if loc, ok := s.references.clicked(gtx); ok {
+		s.openLocation(loc)
+	}
+	return s.references.Layout(gtx, s.theme)
+}
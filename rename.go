@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"gioui.org/font"
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"gioui.org/x/richtext"
+	"github.com/chapar-rest/uikit/button"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/mirzakhany/void/lsp"
+	"go.lsp.dev/protocol"
+)
+
+// renameCmdTag is the tag for the F2 rename command registered with the editor.
+var renameCmdTag struct{}
+
+// renameStage is the step the rename dialog is at.
+type renameStage int
+
+const (
+	renameInput   renameStage = iota // asking for the new name
+	renamePreview                    // listing the changes before they are applied
+)
+
+// renameChange is one text edit in the rename preview.
+type renameChange struct {
+	hit     *refHit // the edited line, with the replaced span
+	newText string
+}
+
+// renameFile groups the preview changes of one file.
+type renameFile struct {
+	path    string
+	changes []renameChange
+}
+
+// renameDialog asks for a new name, sends textDocument/rename and previews the resulting
+// WorkspaceEdit; nothing is changed until the user applies it.
+type renameDialog struct {
+	visible bool
+	stage   renameStage
+	client  *lsp.Client
+	docURI  protocol.DocumentURI
+	pos     protocol.Position
+	oldName string
+	input   widget.Editor
+	status  string // error or progress shown under the input
+	edit    protocol.WorkspaceEdit
+	files   []renameFile
+	changes int
+	list    widget.List
+	ok      widget.Clickable
+	cancel  widget.Clickable
+	focus   bool
+	closed  bool
+}
+
+// startRename checks with the server that the symbol at runeOff in text can be renamed and opens
+// the rename dialog for it.
+func (s *appState) startRename(c *lsp.Client, docURI protocol.DocumentURI, text string, runeOff int) {
+	if !c.Supports(protocol.MethodTextDocumentRename) {
+		log.Printf("[LSP] server does not support %s", protocol.MethodTextDocumentRename)
+		return
+	}
+	pos := lsp.RuneOffsetToPosition(text, runeOff)
+	name := wordAt([]rune(text), runeOff)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		var rng *protocol.Range
+		var placeholder string
+		var err error
+		if c.Supports(protocol.MethodTextDocumentPrepareRename) {
+			rng, placeholder, err = c.PrepareRename(ctx, docURI, pos.Line, pos.Character)
+		} else {
+			// Without prepareRename, let rename itself decide whether the symbol can be renamed.
+			rng = &protocol.Range{Start: pos, End: pos}
+		}
+		if err != nil {
+			log.Printf("[LSP] prepareRename failed for %q: %v", docURI, err)
+			return
+		} else if rng == nil {
+			log.Printf("[LSP] rename: nothing to rename at %s:%d:%d", docURI, pos.Line+1, pos.Character+1)
+			return
+		} else if placeholder != "" {
+			name = placeholder
+		} else if rng.Start != rng.End {
+			start, end := lsp.RangeToRuneOffsets(text, *rng)
+			name = string([]rune(text)[start:end])
+		}
+		s.runOnUI(func() {
+			s.rename.open(c, docURI, pos, name)
+		})
+	}()
+}
+
+// open shows the dialog asking for a new name for oldName.
+func (d *renameDialog) open(c *lsp.Client, docURI protocol.DocumentURI, pos protocol.Position, oldName string) {
+	*d = renameDialog{
+		visible: true,
+		stage:   renameInput,
+		client:  c,
+		docURI:  docURI,
+		pos:     pos,
+		oldName: oldName,
+		focus:   true,
+	}
+	d.input.SingleLine = true
+	d.input.Submit = true
+	d.input.SetText(oldName)
+	d.input.SetCaret(len([]rune(oldName)), 0)
+}
+
+// hide closes the dialog without changing anything.
+func (d *renameDialog) hide() {
+	d.visible = false
+	d.files = nil
+	d.edit = protocol.WorkspaceEdit{}
+	d.closed = true
+}
+
+// requestRename sends textDocument/rename with the entered name and moves on to the preview.
+func (s *appState) requestRename() {
+	d := &s.rename
+	newName := strings.TrimSpace(d.input.Text())
+	if newName == "" || newName == d.oldName {
+		d.hide()
+		return
+	}
+	d.status = "Renaming…"
+	c, docURI, pos := d.client, d.docURI, d.pos
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		edit, err := c.Rename(ctx, docURI, pos.Line, pos.Character, newName)
+		s.runOnUI(func() {
+			if !d.visible || d.docURI != docURI || d.pos != pos {
+				return
+			}
+			switch {
+			case err != nil:
+				d.status = err.Error()
+			case edit == nil:
+				d.status = "The server returned no changes"
+			default:
+				s.previewRename(*edit)
+			}
+		})
+	}()
+}
+
+// previewRename switches the dialog to the list of changes edit would make.
+func (s *appState) previewRename(edit protocol.WorkspaceEdit) {
+	d := &s.rename
+	d.stage = renamePreview
+	d.status = ""
+	d.edit = edit
+	d.files = nil
+	d.changes = 0
+	for _, f := range workspaceEditFiles(edit) {
+		var text string
+		if fv, ok := s.openFiles[f.path]; ok {
+			text = fv.Editor.Text()
+		} else if data, err := os.ReadFile(f.path); err == nil {
+			text = string(data)
+		}
+		runes := []rune(text)
+		rf := renameFile{path: f.path}
+		for _, e := range f.edits {
+			rf.changes = append(rf.changes, renameChange{
+				hit:     newRefHit(protocol.Location{URI: f.uri, Range: e.Range}, text, runes),
+				newText: e.NewText,
+			})
+		}
+		d.changes += len(rf.changes)
+		d.files = append(d.files, rf)
+	}
+	d.list.Position = layout.Position{}
+	d.focus = true
+}
+
+// applyRename applies the previewed edit and closes the dialog.
+func (s *appState) applyRename() {
+	if err := s.applyWorkspaceEdit(s.rename.edit); err != nil {
+		log.Printf("[LSP] rename: %v", err)
+	}
+	s.rename.hide()
+}
+
+// layoutRename handles the rename dialog's input and draws it.
+func (s *appState) layoutRename(gtx layout.Context) layout.Dimensions {
+	d := &s.rename
+	if !d.visible {
+		return layout.Dimensions{}
+	}
+	for {
+		ev, ok := gtx.Event(
+			key.Filter{Focus: d, Name: key.NameEscape},
+			key.Filter{Focus: d, Name: key.NameEnter},
+			key.Filter{Focus: d, Name: key.NameReturn},
+			key.Filter{Focus: &d.input, Name: key.NameEscape},
+		)
+		if !ok {
+			break
+		}
+		e, ok := ev.(key.Event)
+		if !ok || e.State != key.Press {
+			continue
+		}
+		switch {
+		case e.Name == key.NameEscape:
+			d.hide()
+			return layout.Dimensions{}
+		case d.stage == renamePreview:
+			s.applyRename()
+			return layout.Dimensions{}
+		}
+	}
+	for {
+		ev, ok := d.input.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, ok := ev.(widget.SubmitEvent); ok && d.stage == renameInput {
+			s.requestRename()
+		}
+	}
+	if d.cancel.Clicked(gtx) {
+		d.hide()
+		return layout.Dimensions{}
+	}
+	if d.ok.Clicked(gtx) {
+		if d.stage == renameInput {
+			s.requestRename()
+		} else {
+			s.applyRename()
+			return layout.Dimensions{}
+		}
+	}
+	if d.focus {
+		d.focus = false
+		if d.stage == renameInput {
+			gtx.Execute(key.FocusCmd{Tag: &d.input})
+		} else {
+			gtx.Execute(key.FocusCmd{Tag: d})
+		}
+	}
+
+	th := s.theme
+	layoutModal(gtx, th, d, unit.Dp(640), func(gtx layout.Context) layout.Dimensions {
+		return layout.Inset{Left: unit.Dp(6), Right: unit.Dp(6), Top: unit.Dp(2), Bottom: unit.Dp(2)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					title := fmt.Sprintf("Rename %q", d.oldName)
+					if d.stage == renamePreview {
+						title = fmt.Sprintf("Rename %q to %q: %d changes in %d files", d.oldName, strings.TrimSpace(d.input.Text()), d.changes, len(d.files))
+					}
+					lb := material.Label(th.Material(), unit.Sp(12), title)
+					lb.Color = th.Base.TextSubtle
+					return lb.Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					if d.stage != renameInput {
+						return layout.Dimensions{}
+					}
+					return layout.Inset{Top: unit.Dp(8), Bottom: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+						ed := material.Editor(th.Material(), &d.input, "New name")
+						ed.Font = EditorFont()
+						ed.TextSize = unit.Sp(14)
+						ed.Color = th.Base.Text
+						return ed.Layout(gtx)
+					})
+				}),
+				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+					if d.stage != renamePreview {
+						return layout.Dimensions{}
+					}
+					return layout.Inset{Top: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+						return d.layoutChanges(gtx, th)
+					})
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					if d.status == "" {
+						return layout.Dimensions{}
+					}
+					lb := material.Label(th.Material(), unit.Sp(12), d.status)
+					lb.Color = th.Base.Warning
+					return lb.Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Inset{Top: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+						return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceStart}.Layout(gtx,
+							layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+								return button.TextButton(th, &d.cancel, "Cancel", theme.KindSecondary).Layout(gtx, th)
+							}),
+							layout.Rigid(layout.Spacer{Width: unit.Dp(8)}.Layout),
+							layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+								label := "Preview"
+								if d.stage == renamePreview {
+									label = "Apply"
+								}
+								return button.TextButton(th, &d.ok, label, theme.KindPrimary).Layout(gtx, th)
+							}),
+						)
+					})
+				}),
+			)
+		})
+	})
+	return layout.Dimensions{Size: gtx.Constraints.Max}
+}
+
+// layoutChanges lists the previewed changes grouped by file.
+func (d *renameDialog) layoutChanges(gtx layout.Context, th *theme.Theme) layout.Dimensions {
+	type row struct {
+		file   *renameFile
+		change *renameChange
+	}
+	var rows []row
+	for i := range d.files {
+		f := &d.files[i]
+		rows = append(rows, row{file: f})
+		for j := range f.changes {
+			rows = append(rows, row{file: f, change: &f.changes[j]})
+		}
+	}
+	d.list.Axis = layout.Vertical
+	return material.List(th.Material(), &d.list).Layout(gtx, len(rows), func(gtx layout.Context, i int) layout.Dimensions {
+		r := rows[i]
+		if r.change == nil {
+			return layout.Inset{Top: unit.Dp(4), Bottom: unit.Dp(2)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				lb := material.Label(th.Material(), unit.Sp(12), fmt.Sprintf("%s (%d)", r.file.path, len(r.file.changes)))
+				lb.Color = th.Base.Text
+				return lb.Layout(gtx)
+			})
+		}
+		return layout.Inset{Left: unit.Dp(16), Top: unit.Dp(1), Bottom: unit.Dp(1)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Baseline}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					gtx.Constraints.Min.X = gtx.Dp(unit.Dp(40))
+					lb := material.Label(th.Material(), unit.Sp(11), fmt.Sprintf("%d", r.change.hit.loc.Range.Start.Line+1))
+					lb.Color = th.Base.TextSubtle
+					return lb.Layout(gtx)
+				}),
+				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+					return richtext.Text(nil, th.Material().Shaper, changeSpans(th, r.change)...).Layout(gtx)
+				}),
+			)
+		})
+	})
+}
+
+// changeSpans styles a preview line with the replaced text in the danger color, followed by its
+// replacement in bold.
+func changeSpans(th *theme.Theme, c *renameChange) []richtext.SpanStyle {
+	hit := c.hit
+	size := unit.Sp(12)
+	span := func(text string, col func(ss *richtext.SpanStyle)) richtext.SpanStyle {
+		ss := richtext.SpanStyle{Font: EditorFont(), Size: size, Color: th.Base.TextSubtle, Content: strings.ReplaceAll(text, "\t", "    ")}
+		if col != nil {
+			col(&ss)
+		}
+		return ss
+	}
+	var spans []richtext.SpanStyle
+	if before := string(hit.preview[:hit.start]); before != "" {
+		spans = append(spans, span(before, nil))
+	}
+	if old := string(hit.preview[hit.start:hit.end]); old != "" {
+		spans = append(spans, span(old, func(ss *richtext.SpanStyle) { ss.Color = th.Base.Danger }))
+	}
+	if c.newText != "" {
+		spans = append(spans, span(c.newText, func(ss *richtext.SpanStyle) {
+			ss.Color = th.Base.Primary
+			ss.Font.Weight = font.Bold
+		}))
+	}
+	if after := string(hit.preview[hit.end:]); after != "" {
+		spans = append(spans, span(after, nil))
+	}
+	return spans
+}
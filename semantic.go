@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/mirzakhany/void/lsp"
+	"github.com/oligo/gvcode"
+	"github.com/oligo/gvcode/textstyle/syntax"
+	"go.lsp.dev/protocol"
+)
+
+// semanticTokensDelay is how long highlighting waits after an edit before asking the server for
+// semantic tokens, so typing does not send a request per keystroke.
+const semanticTokensDelay = 300 * time.Millisecond
+
+// semanticScopeModifiers are the token modifiers that pick a more specific semantic scope, in
+// order of preference (see semanticScope).
+var semanticScopeModifiers = []string{"defaultLibrary", "readonly"}
+
+// semanticTokenStyles maps semantic scopes ("semantic.<type>[.<modifier>]") to the chroma token
+// type whose color they take in buildColorSchemeFromChroma.
+var semanticTokenStyles = []struct {
+	scope syntax.StyleScope
+	token chroma.TokenType
+}{
+	{"semantic.namespace", chroma.NameNamespace},
+	{"semantic.type", chroma.NameClass},
+	{"semantic.type.defaultLibrary", chroma.KeywordType},
+	{"semantic.class", chroma.NameClass},
+	{"semantic.struct", chroma.NameClass},
+	{"semantic.interface", chroma.NameClass},
+	{"semantic.enum", chroma.NameClass},
+	{"semantic.typeParameter", chroma.NameClass},
+	{"semantic.parameter", chroma.NameVariable},
+	{"semantic.variable", chroma.Name},
+	{"semantic.variable.readonly", chroma.NameConstant},
+	{"semantic.variable.defaultLibrary", chroma.KeywordConstant},
+	{"semantic.property", chroma.NameAttribute},
+	{"semantic.enumMember", chroma.NameConstant},
+	{"semantic.function", chroma.NameFunction},
+	{"semantic.function.defaultLibrary", chroma.NameBuiltin},
+	{"semantic.method", chroma.NameFunction},
+	{"semantic.macro", chroma.CommentPreproc},
+	{"semantic.decorator", chroma.NameDecorator},
+	{"semantic.label", chroma.NameLabel},
+	{"semantic.keyword", chroma.Keyword},
+	{"semantic.comment", chroma.Comment},
+	{"semantic.string", chroma.LiteralString},
+	{"semantic.number", chroma.LiteralNumber},
+	{"semantic.regexp", chroma.LiteralStringRegex},
+	{"semantic.operator", chroma.Operator},
+}
+
+// highlighter computes an editor's syntax tokens: chroma's lexical tokens, with the semantic
+// tokens of the language server layered on top when it has them.
+type highlighter struct {
+	path  string
+	style *chroma.Style
+	// scopes are the style scopes of the editor's color scheme; semantic tokens without a styled
+	// scope are left to chroma.
+	scopes []syntax.StyleScope
+	// semantic are the semantic tokens, as rune offsets into text.
+	semantic []syntax.Token
+	text     string
+	// result is the server's last result, the base for delta requests.
+	result *lsp.SemanticTokens
+	timer  *time.Timer
+	// seq is bumped on every request so late responses are dropped.
+	seq int
+}
+
+// newHighlighter returns a highlighter for the file at path. scopes are the style scopes of the
+// editor's color scheme.
+func newHighlighter(path string, style *chroma.Style, scopes []syntax.StyleScope) *highlighter {
+	return &highlighter{path: path, style: style, scopes: scopes}
+}
+
+// apply re-tokenizes the editor text with chroma and sets it with the semantic tokens on top.
+// Semantic tokens from before an edit are shifted to where their text moved; the ones the edit
+// touched are dropped until the server sends new ones.
+func (h *highlighter) apply(ed *gvcode.Editor) {
+	text := ed.Text()
+	if text != h.text {
+		h.semantic = shiftSyntaxTokens(h.semantic, h.text, text)
+		h.text = text
+	}
+	tokens := mergeSyntaxTokens(chromaTokensToGvcode(h.path, text, h.style), h.semantic)
+	if len(tokens) > 0 {
+		ed.SetSyntaxTokens(tokens...)
+	}
+}
+
+// schedule requests semantic tokens for the editor's document after semanticTokensDelay,
+// replacing any request scheduled before.
+func (h *highlighter) schedule(s *appState, c *lsp.Client, docURI protocol.DocumentURI, ed *gvcode.Editor) {
+	if !c.Supports(protocol.MethodSemanticTokensFull) {
+		return
+	}
+	h.seq++
+	seq := h.seq
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+	h.timer = time.AfterFunc(semanticTokensDelay, func() {
+		s.runOnUI(func() {
+			if seq == h.seq {
+				h.request(s, c, docURI, ed)
+			}
+		})
+	})
+}
+
+// request asks the server for semantic tokens in the background and applies them.
+func (h *highlighter) request(s *appState, c *lsp.Client, docURI protocol.DocumentURI, ed *gvcode.Editor) {
+	seq := h.seq
+	text := ed.Text()
+	prev := h.result
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		result, err := c.SemanticTokens(ctx, docURI, prev)
+		if err != nil {
+			log.Printf("[LSP] semanticTokens failed for %q: %v", docURI, err)
+			return
+		}
+		tokens := h.syntaxTokens(c.DecodeSemanticTokens(text, result))
+		s.runOnUI(func() {
+			h.result = result
+			if seq != h.seq {
+				return
+			}
+			h.semantic = tokens
+			h.text = text
+			h.apply(ed)
+		})
+	}()
+}
+
+// syntaxTokens converts decoded semantic tokens to syntax tokens, dropping the ones without a
+// styled scope and any that overlap the token before them.
+func (h *highlighter) syntaxTokens(decoded []lsp.SemanticToken) []syntax.Token {
+	tokens := make([]syntax.Token, 0, len(decoded))
+	end := 0
+	for _, t := range decoded {
+		scope := semanticScope(t)
+		for scope.IsValid() && !slices.Contains(h.scopes, scope) {
+			scope = scope.Parent()
+		}
+		if scope == "" || scope == "semantic" || t.Start < end || t.Start >= t.End {
+			continue
+		}
+		tokens = append(tokens, syntax.Token{Start: t.Start, End: t.End, Scope: scope})
+		end = t.End
+	}
+	return tokens
+}
+
+// semanticScope returns the style scope of a semantic token: "semantic.<type>", extended with the
+// first of semanticScopeModifiers the token has.
+func semanticScope(t lsp.SemanticToken) syntax.StyleScope {
+	scope := "semantic." + t.Type
+	for _, mod := range semanticScopeModifiers {
+		if slices.Contains(t.Modifiers, mod) {
+			scope += "." + mod
+			break
+		}
+	}
+	return syntax.StyleScope(scope)
+}
+
+// mergeSyntaxTokens layers overlay on base: base tokens are cut where an overlay token covers
+// them. Both must be sorted and must not overlap themselves.
+func mergeSyntaxTokens(base, overlay []syntax.Token) []syntax.Token {
+	if len(overlay) == 0 {
+		return base
+	}
+	merged := make([]syntax.Token, 0, len(base)+2*len(overlay))
+	j := 0
+	covered := 0 // end of the last overlay token added
+	for _, t := range base {
+		start := max(t.Start, covered)
+		for start < t.End {
+			if j < len(overlay) && overlay[j].Start <= start {
+				merged = append(merged, overlay[j])
+				covered = overlay[j].End
+				start = max(start, covered)
+				j++
+				continue
+			}
+			end := t.End
+			if j < len(overlay) {
+				end = min(end, overlay[j].Start)
+			}
+			merged = append(merged, syntax.Token{Start: start, End: end, Scope: t.Scope})
+			start = end
+		}
+	}
+	return append(merged, overlay[j:]...)
+}
+
+// shiftSyntaxTokens moves tokens computed for oldText to where their text is in newText. Tokens
+// that overlap the changed text are dropped.
+func shiftSyntaxTokens(tokens []syntax.Token, oldText, newText string) []syntax.Token {
+	if len(tokens) == 0 {
+		return nil
+	}
+	start, oldEnd, delta := changedSpan(oldText, newText)
+	shifted := make([]syntax.Token, 0, len(tokens))
+	for _, t := range tokens {
+		switch {
+		case t.End <= start:
+			shifted = append(shifted, t)
+		case t.Start >= oldEnd:
+			t.Start += delta
+			t.End += delta
+			shifted = append(shifted, t)
+		}
+	}
+	return shifted
+}
+
+// changedSpan compares two versions of a text and returns the rune offsets of the part of oldText
+// that was replaced, [start, oldEnd), and how far the text after it moved.
+func changedSpan(oldText, newText string) (start, oldEnd, delta int) {
+	prefix := 0
+	for prefix < len(oldText) && prefix < len(newText) && oldText[prefix] == newText[prefix] {
+		prefix++
+	}
+	for prefix > 0 && prefix < len(oldText) && !utf8.RuneStart(oldText[prefix]) {
+		prefix--
+	}
+	suffix := 0
+	for suffix < len(oldText)-prefix && suffix < len(newText)-prefix &&
+		oldText[len(oldText)-1-suffix] == newText[len(newText)-1-suffix] {
+		suffix++
+	}
+	for suffix > 0 && !utf8.RuneStart(oldText[len(oldText)-suffix]) {
+		suffix--
+	}
+	start = utf8.RuneCountInString(oldText[:prefix])
+	oldEnd = start + utf8.RuneCountInString(oldText[prefix:len(oldText)-suffix])
+	delta = utf8.RuneCountInString(newText[prefix:len(newText)-suffix]) - (oldEnd - start)
+	return start, oldEnd, delta
+}
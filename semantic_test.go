@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/oligo/gvcode/textstyle/syntax"
+)
+
+func TestMergeSyntaxTokens(t *testing.T) {
+	tok := func(start, end int, scope string) syntax.Token {
+		return syntax.Token{Start: start, End: end, Scope: syntax.StyleScope(scope)}
+	}
+	tests := []struct {
+		name          string
+		base, overlay []syntax.Token
+		want          []syntax.Token
+	}{
+		{"no overlay", []syntax.Token{tok(0, 4, "a")}, nil, []syntax.Token{tok(0, 4, "a")}},
+		{
+			name:    "inside a token",
+			base:    []syntax.Token{tok(0, 10, "a")},
+			overlay: []syntax.Token{tok(3, 5, "x")},
+			want:    []syntax.Token{tok(0, 3, "a"), tok(3, 5, "x"), tok(5, 10, "a")},
+		},
+		{
+			name:    "across tokens",
+			base:    []syntax.Token{tok(0, 4, "a"), tok(4, 8, "b")},
+			overlay: []syntax.Token{tok(2, 6, "x")},
+			want:    []syntax.Token{tok(0, 2, "a"), tok(2, 6, "x"), tok(6, 8, "b")},
+		},
+		{
+			name:    "same span",
+			base:    []syntax.Token{tok(0, 4, "a"), tok(4, 8, "b")},
+			overlay: []syntax.Token{tok(4, 8, "x")},
+			want:    []syntax.Token{tok(0, 4, "a"), tok(4, 8, "x")},
+		},
+		{
+			name:    "several in one token",
+			base:    []syntax.Token{tok(0, 10, "a")},
+			overlay: []syntax.Token{tok(1, 2, "x"), tok(2, 4, "y"), tok(6, 7, "z")},
+			want:    []syntax.Token{tok(0, 1, "a"), tok(1, 2, "x"), tok(2, 4, "y"), tok(4, 6, "a"), tok(6, 7, "z"), tok(7, 10, "a")},
+		},
+		{
+			name:    "in a gap",
+			base:    []syntax.Token{tok(0, 2, "a"), tok(5, 8, "b")},
+			overlay: []syntax.Token{tok(3, 4, "x")},
+			want:    []syntax.Token{tok(0, 2, "a"), tok(3, 4, "x"), tok(5, 8, "b")},
+		},
+		{
+			name:    "over a gap",
+			base:    []syntax.Token{tok(0, 2, "a"), tok(5, 8, "b")},
+			overlay: []syntax.Token{tok(1, 6, "x")},
+			want:    []syntax.Token{tok(0, 1, "a"), tok(1, 6, "x"), tok(6, 8, "b")},
+		},
+		{
+			name:    "past the end",
+			base:    []syntax.Token{tok(0, 4, "a")},
+			overlay: []syntax.Token{tok(6, 8, "x")},
+			want:    []syntax.Token{tok(0, 4, "a"), tok(6, 8, "x")},
+		},
+	}
+	for _, tt := range tests {
+		if got := mergeSyntaxTokens(tt.base, tt.overlay); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChangedSpan(t *testing.T) {
+	tests := []struct {
+		oldText, newText     string
+		start, oldEnd, delta int
+	}{
+		{"abc", "abc", 3, 3, 0},
+		{"", "abc", 0, 0, 3},
+		{"abc", "", 0, 3, -3},
+		{"abc", "abXc", 2, 2, 1},
+		{"abXc", "abc", 2, 3, -1},
+		{"hello world", "hello there world", 6, 6, 6},
+		{"abc", "aXYc", 1, 2, 1},
+		{"aa", "aaa", 2, 2, 1},
+		// Offsets are in runes; "𝒳" is four bytes.
+		{"𝒳a", "𝒳ba", 1, 1, 1},
+		// A shared leading or trailing byte of different runes is not part of the prefix or suffix.
+		{"é", "è", 0, 1, 0},
+		{"ä", "Ĥ", 0, 1, 0},
+	}
+	for _, tt := range tests {
+		start, oldEnd, delta := changedSpan(tt.oldText, tt.newText)
+		if start != tt.start || oldEnd != tt.oldEnd || delta != tt.delta {
+			t.Errorf("changedSpan(%q, %q) = %d, %d, %d; want %d, %d, %d", tt.oldText, tt.newText, start, oldEnd, delta, tt.start, tt.oldEnd, tt.delta)
+		}
+	}
+}
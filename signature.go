@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"slices"
+	"strings"
+
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+	"gioui.org/x/richtext"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/mirzakhany/void/lsp"
+	"github.com/oligo/gvcode"
+	"go.lsp.dev/protocol"
+)
+
+// signaturePopup shows textDocument/signatureHelp above the caret while call arguments are typed.
+// It opens on one of the server's trigger characters, follows the caret while it is showing and
+// closes on ")" or Escape, or when the server has no signature for the caret position.
+type signaturePopup struct {
+	help    *lsp.SignatureHelp
+	visible bool
+	doc     markdownView
+	// caret is the rune offset the last request was made for; the popup is re-requested when the caret moves.
+	caret int
+	// seq is bumped on every request and on hide so late responses are dropped.
+	seq int
+}
+
+// update requests signature help after an edit that typed a trigger character and re-requests it
+// when the caret moved while the popup is showing. changed reports whether the text was edited
+// this frame.
+func (p *signaturePopup) update(s *appState, c *lsp.Client, docURI protocol.DocumentURI, ed *gvcode.Editor, changed bool) {
+	line, col := ed.CaretPos()
+	runeOff, _ := ed.ConvertPos(line, col)
+	if changed {
+		text := ed.Text()
+		var typed string
+		if runes := []rune(text); runeOff > 0 && runeOff <= len(runes) {
+			typed = string(runes[runeOff-1])
+		}
+		switch {
+		case typed == ")":
+			p.hide()
+			return
+		case slices.Contains(c.SignatureHelpTriggerCharacters(), typed):
+			p.request(s, c, docURI, text, runeOff, typed)
+			return
+		}
+	}
+	if p.visible && (changed || runeOff != p.caret) {
+		p.request(s, c, docURI, ed.Text(), runeOff, "")
+	}
+}
+
+// request asks the server for signature help at runeOff in the background. triggerChar is the
+// typed trigger character, if any.
+func (p *signaturePopup) request(s *appState, c *lsp.Client, docURI protocol.DocumentURI, text string, runeOff int, triggerChar string) {
+	if !c.Supports(protocol.MethodTextDocumentSignatureHelp) {
+		return
+	}
+	p.seq++
+	seq := p.seq
+	p.caret = runeOff
+	retrigger := p.visible
+	pos := lsp.RuneOffsetToPosition(text, runeOff)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		help, err := c.SignatureHelp(ctx, docURI, pos.Line, pos.Character, triggerChar, retrigger)
+		if err != nil {
+			log.Printf("[LSP] signatureHelp failed for %q: %v", docURI, err)
+		}
+		s.runOnUI(func() {
+			if seq != p.seq {
+				return
+			}
+			p.show(help)
+		})
+	}()
+}
+
+// show displays help, or hides the popup if there is no signature.
+func (p *signaturePopup) show(help *lsp.SignatureHelp) {
+	if help == nil || len(help.Signatures) == 0 {
+		p.hide()
+		return
+	}
+	p.help = help
+	p.visible = true
+	doc := help.Signatures[help.ActiveSignature].Documentation
+	if doc.Kind == protocol.PlainText {
+		p.doc.SetPlainText(doc.Value)
+	} else {
+		p.doc.SetText(doc.Value)
+	}
+}
+
+// hide closes the popup and drops any in-flight request.
+func (p *signaturePopup) hide() {
+	p.seq++
+	p.visible = false
+	p.help = nil
+}
+
+// Layout draws the popup above the caret line (below it if there is no room above).
+// lineHeight is the height of an editor line.
+func (p *signaturePopup) Layout(gtx layout.Context, th *theme.Theme, ed *gvcode.Editor, lineHeight int) {
+	if !p.visible {
+		return
+	}
+	macro := op.Record(gtx.Ops)
+	dims := p.layoutContent(gtx, th)
+	call := macro.Stop()
+
+	caret := ed.CaretCoords()
+	pos := image.Pt(int(caret.X), int(caret.Y))
+	if above := pos.Y - lineHeight - dims.Size.Y; above >= 0 {
+		pos.Y = above
+	}
+	ed.PaintOverlay(gtx, pos, func(gtx layout.Context) layout.Dimensions {
+		call.Add(gtx.Ops)
+		return dims
+	})
+}
+
+func (p *signaturePopup) layoutContent(gtx layout.Context, th *theme.Theme) layout.Dimensions {
+	sig := p.help.Signatures[p.help.ActiveSignature]
+	pad := unit.Dp(8)
+	gtx.Constraints.Min = image.Point{}
+	gtx.Constraints.Max.X = min(gtx.Constraints.Max.X, gtx.Dp(unit.Dp(560))+gtx.Dp(pad)*2)
+	gtx.Constraints.Max.Y = min(gtx.Constraints.Max.Y, gtx.Dp(unit.Dp(160)))
+
+	macro := op.Record(gtx.Ops)
+	dims := layout.UniformInset(pad).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Baseline}.Layout(gtx,
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						if len(p.help.Signatures) < 2 {
+							return layout.Dimensions{}
+						}
+						counter := fmt.Sprintf("%d/%d", p.help.ActiveSignature+1, len(p.help.Signatures))
+						return layout.Inset{Right: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							lb := material.Label(th.Material(), unit.Sp(11), counter)
+							lb.Color = th.Base.TextSubtle
+							return lb.Layout(gtx)
+						})
+					}),
+					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+						return richtext.Text(nil, th.Material().Shaper, signatureSpans(th, sig)...).Layout(gtx)
+					}),
+				)
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				if strings.TrimSpace(sig.Documentation.Value) == "" {
+					return layout.Dimensions{}
+				}
+				return layout.Inset{Top: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return p.doc.Layout(gtx, th, unit.Sp(12))
+				})
+			}),
+		)
+	})
+	call := macro.Stop()
+
+	rr := clip.UniformRRect(image.Rectangle{Max: dims.Size}, gtx.Dp(unit.Dp(6)))
+	defer rr.Push(gtx.Ops).Pop()
+	paint.Fill(gtx.Ops, th.Base.SurfaceHighlight)
+	call.Add(gtx.Ops)
+	return dims
+}
+
+// signatureSpans styles a signature label with its active parameter emphasized.
+func signatureSpans(th *theme.Theme, sig lsp.Signature) []richtext.SpanStyle {
+	label := []rune(sig.Label)
+	start, end := 0, 0
+	if sig.ActiveParam >= 0 {
+		start, end = sig.Params[sig.ActiveParam][0], sig.Params[sig.ActiveParam][1]
+		end = min(end, len(label))
+		start = min(start, end)
+	}
+	parts := []struct {
+		text   string
+		active bool
+	}{
+		{string(label[:start]), false},
+		{string(label[start:end]), true},
+		{string(label[end:]), false},
+	}
+	size := unit.Sp(13)
+	spans := make([]richtext.SpanStyle, 0, len(parts))
+	for _, part := range parts {
+		if part.text == "" {
+			continue
+		}
+		ss := richtext.SpanStyle{Font: EditorFont(), Size: size, Color: th.Base.Text, Content: part.text}
+		if part.active {
+			ss.Font.Weight = font.Bold
+			ss.Color = th.Base.Primary
+		}
+		spans = append(spans, ss)
+	}
+	return spans
+}
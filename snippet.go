@@ -0,0 +1,457 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// snippetNodeKind is the kind of an element of a parsed snippet.
+type snippetNodeKind int
+
+const (
+	snippetText snippetNodeKind = iota
+	snippetTabStop
+	snippetVariable
+)
+
+// snippetNode is an element of a parsed snippet: literal text, a tab stop ($1, ${1:placeholder}
+// or ${1|one,two|}) or a variable ($NAME or ${NAME:default}).
+type snippetNode struct {
+	kind     snippetNodeKind
+	text     string        // literal text
+	index    int           // tab stop number
+	name     string        // variable name
+	children []snippetNode // placeholder of a tab stop, default of a variable
+	choices  []string
+}
+
+// parseSnippet parses the LSP/TextMate snippet syntax. It never fails: whatever is not a valid
+// tab stop or variable, e.g. an unterminated "${1:", is kept as literal text. Transforms
+// (${1/regex/format/}) are parsed but not applied; the value is used as is.
+func parseSnippet(src string) []snippetNode {
+	p := &snippetParser{src: []rune(src)}
+	nodes, _ := p.parse(false)
+	return nodes
+}
+
+type snippetParser struct {
+	src []rune
+	pos int
+}
+
+// parse reads nodes up to the end of the source or, if nested, up to the unescaped '}' that
+// closes a placeholder. It reports whether that '}' was found.
+func (p *snippetParser) parse(nested bool) ([]snippetNode, bool) {
+	var nodes []snippetNode
+	var text []rune
+	flush := func() {
+		if len(text) > 0 {
+			nodes = append(nodes, snippetNode{kind: snippetText, text: string(text)})
+			text = nil
+		}
+	}
+	for p.pos < len(p.src) {
+		r := p.src[p.pos]
+		switch {
+		case r == '\\' && p.pos+1 < len(p.src) && strings.ContainsRune(`$}\`, p.src[p.pos+1]):
+			text = append(text, p.src[p.pos+1])
+			p.pos += 2
+		case r == '}' && nested:
+			p.pos++
+			flush()
+			return nodes, true
+		case r == '$':
+			start := p.pos
+			if node, ok := p.parseDollar(); ok {
+				flush()
+				nodes = append(nodes, node)
+			} else {
+				p.pos = start + 1
+				text = append(text, r)
+			}
+		default:
+			text = append(text, r)
+			p.pos++
+		}
+	}
+	flush()
+	return nodes, !nested
+}
+
+// parseDollar parses the tab stop or variable starting at the '$' at p.pos.
+func (p *snippetParser) parseDollar() (snippetNode, bool) {
+	p.pos++
+	if p.pos >= len(p.src) {
+		return snippetNode{}, false
+	}
+	if r := p.src[p.pos]; isDigit(r) {
+		return snippetNode{kind: snippetTabStop, index: p.parseInt()}, true
+	} else if isVariableStart(r) {
+		return snippetNode{kind: snippetVariable, name: p.parseName()}, true
+	} else if r != '{' {
+		return snippetNode{}, false
+	}
+	p.pos++
+	var node snippetNode
+	switch {
+	case p.pos < len(p.src) && isDigit(p.src[p.pos]):
+		node = snippetNode{kind: snippetTabStop, index: p.parseInt()}
+	case p.pos < len(p.src) && isVariableStart(p.src[p.pos]):
+		node = snippetNode{kind: snippetVariable, name: p.parseName()}
+	default:
+		return snippetNode{}, false
+	}
+	if p.pos >= len(p.src) {
+		return snippetNode{}, false
+	}
+	switch p.src[p.pos] {
+	case '}':
+		p.pos++
+		return node, true
+	case ':':
+		p.pos++
+		children, ok := p.parse(true)
+		node.children = children
+		if node.children == nil {
+			node.children = []snippetNode{}
+		}
+		return node, ok
+	case '|':
+		if node.kind != snippetTabStop {
+			return snippetNode{}, false
+		}
+		p.pos++
+		choices, ok := p.parseChoices()
+		node.choices = choices
+		return node, ok
+	case '/':
+		p.pos++
+		return node, p.skipTransform()
+	}
+	return snippetNode{}, false
+}
+
+// parseChoices reads the comma-separated choices of ${1|one,two|} up to and including "|}".
+func (p *snippetParser) parseChoices() ([]string, bool) {
+	var choices []string
+	var choice []rune
+	for p.pos < len(p.src) {
+		r := p.src[p.pos]
+		switch {
+		case r == '\\' && p.pos+1 < len(p.src) && strings.ContainsRune(`$}\,|`, p.src[p.pos+1]):
+			choice = append(choice, p.src[p.pos+1])
+			p.pos += 2
+		case r == ',':
+			choices = append(choices, string(choice))
+			choice = nil
+			p.pos++
+		case r == '|':
+			if p.pos+1 >= len(p.src) || p.src[p.pos+1] != '}' {
+				return nil, false
+			}
+			p.pos += 2
+			return append(choices, string(choice)), true
+		default:
+			choice = append(choice, r)
+			p.pos++
+		}
+	}
+	return nil, false
+}
+
+// skipTransform skips the "regex/format/options}" of a transform, whose format may contain
+// nested ${...} of its own.
+func (p *snippetParser) skipTransform() bool {
+	slashes, depth := 0, 0
+	for p.pos < len(p.src) {
+		r := p.src[p.pos]
+		p.pos++
+		switch {
+		case r == '\\':
+			p.pos++
+		case r == '/' && depth == 0:
+			slashes++
+		case r == '{' && slashes == 1:
+			depth++
+		case r == '}' && depth > 0:
+			depth--
+		case r == '}' && slashes >= 2:
+			return true
+		}
+	}
+	return false
+}
+
+func (p *snippetParser) parseInt() int {
+	start := p.pos
+	for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+		p.pos++
+	}
+	n, _ := strconv.Atoi(string(p.src[start:p.pos]))
+	return n
+}
+
+func (p *snippetParser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.src) && (isVariableStart(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isVariableStart(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// snippetStop is a tab stop of an expanded snippet: the rune ranges of its text, the first being
+// the one that is selected and the others mirroring it, and its choices, if any.
+type snippetStop struct {
+	index   int
+	ranges  [][2]int
+	choices []string
+	final   bool // $0, where the caret ends up
+}
+
+// snippetExpansion is a snippet ready to be inserted: its text and its tab stops in the order
+// Tab visits them, the final one last.
+type snippetExpansion struct {
+	text  string
+	stops []snippetStop
+}
+
+// expandSnippet renders the parsed snippet nodes. Variables are looked up with vars, which
+// reports whether it knows a name; unknown variables become tab stops with their name as
+// placeholder, after the numbered ones. Every line after the first is prefixed with indent. A
+// tab stop repeated in the snippet takes the placeholder of its first occurrence that has one,
+// and a snippet without $0 gets one at its end.
+func expandSnippet(nodes []snippetNode, vars func(name string) (string, bool), indent string) snippetExpansion {
+	e := &snippetExpander{
+		vars:         vars,
+		indent:       indent,
+		placeholders: map[int]snippetNode{},
+		stops:        map[int]*snippetStop{},
+		rendering:    map[int]bool{},
+	}
+	e.collect(nodes)
+	e.nextUnknown = e.maxIndex + 1
+	e.render(nodes)
+	exp := snippetExpansion{text: string(e.out)}
+	for _, stop := range e.stops {
+		exp.stops = append(exp.stops, *stop)
+	}
+	slices.SortFunc(exp.stops, func(a, b snippetStop) int { return a.index - b.index })
+	if len(exp.stops) > 0 && exp.stops[0].index == 0 {
+		final := exp.stops[0]
+		exp.stops = append(exp.stops[1:], final)
+	} else {
+		exp.stops = append(exp.stops, snippetStop{ranges: [][2]int{{len(e.out), len(e.out)}}})
+	}
+	exp.stops[len(exp.stops)-1].final = true
+	return exp
+}
+
+type snippetExpander struct {
+	vars   func(name string) (string, bool)
+	indent string
+	out    []rune
+	// placeholders is the first occurrence with a placeholder or choices of each tab stop.
+	placeholders map[int]snippetNode
+	stops        map[int]*snippetStop
+	// rendering guards against a placeholder that contains its own tab stop.
+	rendering   map[int]bool
+	maxIndex    int
+	nextUnknown int
+}
+
+func (e *snippetExpander) collect(nodes []snippetNode) {
+	for _, n := range nodes {
+		if n.kind == snippetTabStop {
+			e.maxIndex = max(e.maxIndex, n.index)
+			if _, ok := e.placeholders[n.index]; !ok && (n.children != nil || n.choices != nil) {
+				e.placeholders[n.index] = n
+			}
+		}
+		e.collect(n.children)
+	}
+}
+
+func (e *snippetExpander) render(nodes []snippetNode) {
+	for _, n := range nodes {
+		switch n.kind {
+		case snippetText:
+			e.write(n.text)
+		case snippetTabStop:
+			start := len(e.out)
+			if def, ok := e.placeholders[n.index]; ok && !e.rendering[n.index] {
+				e.rendering[n.index] = true
+				if len(def.choices) > 0 {
+					e.write(def.choices[0])
+				} else {
+					e.render(def.children)
+				}
+				e.rendering[n.index] = false
+			}
+			stop := e.stop(n.index)
+			if stop.choices == nil {
+				stop.choices = e.placeholders[n.index].choices
+			}
+			stop.ranges = append(stop.ranges, [2]int{start, len(e.out)})
+		case snippetVariable:
+			value, known := e.vars(n.name)
+			switch {
+			case !known:
+				start := len(e.out)
+				e.write(n.name)
+				e.stop(e.nextUnknown).ranges = [][2]int{{start, len(e.out)}}
+				e.nextUnknown++
+			case value == "":
+				e.render(n.children)
+			default:
+				e.write(value)
+			}
+		}
+	}
+}
+
+func (e *snippetExpander) stop(index int) *snippetStop {
+	stop, ok := e.stops[index]
+	if !ok {
+		stop = &snippetStop{index: index}
+		e.stops[index] = stop
+	}
+	return stop
+}
+
+// write appends s, indenting the lines after the first.
+func (e *snippetExpander) write(s string) {
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			e.out = append(e.out, '\n')
+			e.out = append(e.out, []rune(e.indent)...)
+		}
+		e.out = append(e.out, []rune(line)...)
+	}
+}
+
+// snippetContext is where a snippet is inserted, for resolving its variables.
+type snippetContext struct {
+	path     string // the document's path
+	lang     string // the document's language ID
+	line     int    // 0-based line of the insertion
+	lineText string
+	word     string // the word at the insertion
+	selected string
+}
+
+// variable resolves the TextMate snippet variables (TM_FILENAME, CURRENT_YEAR, ...). The
+// clipboard is not available to snippets, so CLIPBOARD is always empty.
+func (c snippetContext) variable(name string) (string, bool) {
+	now := time.Now()
+	abs, _ := filepath.Abs(c.path)
+	switch name {
+	case "TM_SELECTED_TEXT":
+		return c.selected, true
+	case "TM_CURRENT_LINE":
+		return c.lineText, true
+	case "TM_CURRENT_WORD":
+		return c.word, true
+	case "TM_LINE_INDEX":
+		return strconv.Itoa(c.line), true
+	case "TM_LINE_NUMBER":
+		return strconv.Itoa(c.line + 1), true
+	case "TM_FILENAME":
+		return filepath.Base(c.path), true
+	case "TM_FILENAME_BASE":
+		base := filepath.Base(c.path)
+		return strings.TrimSuffix(base, filepath.Ext(base)), true
+	case "TM_DIRECTORY":
+		return filepath.Dir(abs), true
+	case "TM_FILEPATH":
+		return abs, true
+	case "RELATIVE_FILEPATH":
+		return projectPath(c.path), true
+	case "WORKSPACE_NAME", "WORKSPACE_FOLDER":
+		root, _ := filepath.Abs(".")
+		if name == "WORKSPACE_NAME" {
+			return filepath.Base(root), true
+		}
+		return root, true
+	case "CLIPBOARD":
+		return "", true
+	case "CURRENT_YEAR":
+		return strconv.Itoa(now.Year()), true
+	case "CURRENT_YEAR_SHORT":
+		return fmt.Sprintf("%02d", now.Year()%100), true
+	case "CURRENT_MONTH":
+		return fmt.Sprintf("%02d", int(now.Month())), true
+	case "CURRENT_MONTH_NAME":
+		return now.Month().String(), true
+	case "CURRENT_MONTH_NAME_SHORT":
+		return now.Month().String()[:3], true
+	case "CURRENT_DATE":
+		return fmt.Sprintf("%02d", now.Day()), true
+	case "CURRENT_DAY_NAME":
+		return now.Weekday().String(), true
+	case "CURRENT_DAY_NAME_SHORT":
+		return now.Weekday().String()[:3], true
+	case "CURRENT_HOUR":
+		return fmt.Sprintf("%02d", now.Hour()), true
+	case "CURRENT_MINUTE":
+		return fmt.Sprintf("%02d", now.Minute()), true
+	case "CURRENT_SECOND":
+		return fmt.Sprintf("%02d", now.Second()), true
+	case "CURRENT_SECONDS_UNIX":
+		return strconv.FormatInt(now.Unix(), 10), true
+	case "RANDOM":
+		return randomDigits(6, 10), true
+	case "RANDOM_HEX":
+		return randomDigits(6, 16), true
+	case "UUID":
+		b := []byte(randomDigits(32, 16))
+		b[12] = '4'
+		b[16] = "89ab"[b[16]%4]
+		return fmt.Sprintf("%s-%s-%s-%s-%s", b[:8], b[8:12], b[12:16], b[16:20], b[20:]), true
+	case "LINE_COMMENT", "BLOCK_COMMENT_START", "BLOCK_COMMENT_END":
+		return commentTokens(c.lang)[name], true
+	}
+	return "", false
+}
+
+// randomDigits returns n random digits in the given base.
+func randomDigits(n, base int) string {
+	var sb strings.Builder
+	for range n {
+		d, err := rand.Int(rand.Reader, big.NewInt(int64(base)))
+		if err != nil {
+			d = big.NewInt(0)
+		}
+		sb.WriteString(strconv.FormatInt(d.Int64(), base))
+	}
+	return sb.String()
+}
+
+// commentTokens returns the comment variables for a language ID.
+func commentTokens(lang string) map[string]string {
+	switch lang {
+	case "python":
+		return map[string]string{"LINE_COMMENT": "#", "BLOCK_COMMENT_START": `"""`, "BLOCK_COMMENT_END": `"""`}
+	default:
+		return map[string]string{"LINE_COMMENT": "//", "BLOCK_COMMENT_START": "/*", "BLOCK_COMMENT_END": "*/"}
+	}
+}
+
+// leadingSpace returns the indentation of line.
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeftFunc(line, unicode.IsSpace))]
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestExpandSnippet(t *testing.T) {
+	vars := func(name string) (string, bool) {
+		switch name {
+		case "TM_FILENAME":
+			return "a.go", true
+		case "EMPTY":
+			return "", true
+		}
+		return "", false
+	}
+	final := func(off int) snippetStop {
+		return snippetStop{ranges: [][2]int{{off, off}}, final: true}
+	}
+	tests := []struct {
+		name   string
+		src    string
+		indent string
+		text   string
+		stops  []snippetStop
+	}{
+		{
+			name:  "escapes",
+			src:   `\$1 \} \\ \x`,
+			text:  `$1 } \ \x`,
+			stops: []snippetStop{final(9)},
+		},
+		{
+			name: "nested placeholders",
+			src:  "${1:a ${2:b}} $0",
+			text: "a b ",
+			stops: []snippetStop{
+				{index: 1, ranges: [][2]int{{0, 3}}},
+				{index: 2, ranges: [][2]int{{2, 3}}},
+				final(4),
+			},
+		},
+		{
+			name: "mirror takes the placeholder",
+			src:  "$1 = ${1:x};",
+			text: "x = x;",
+			stops: []snippetStop{
+				{index: 1, ranges: [][2]int{{0, 1}, {4, 5}}},
+				final(6),
+			},
+		},
+		{
+			name: "choices",
+			src:  `${1|one,two\,three|}`,
+			text: "one",
+			stops: []snippetStop{
+				{index: 1, ranges: [][2]int{{0, 3}}, choices: []string{"one", "two,three"}},
+				final(3),
+			},
+		},
+		{
+			name: "transform is not applied",
+			src:  "${1/(.*)/${1:/upcase}/g}x",
+			text: "x",
+			stops: []snippetStop{
+				{index: 1, ranges: [][2]int{{0, 0}}},
+				final(1),
+			},
+		},
+		{
+			name: "unknown variable becomes a stop after the numbered ones",
+			src:  "$FOO ${1:a}",
+			text: "FOO a",
+			stops: []snippetStop{
+				{index: 1, ranges: [][2]int{{4, 5}}},
+				{index: 2, ranges: [][2]int{{0, 3}}},
+				final(5),
+			},
+		},
+		{
+			name:  "known and empty variables",
+			src:   "${TM_FILENAME} ${EMPTY:def} $TM_FILENAME",
+			text:  "a.go def a.go",
+			stops: []snippetStop{final(13)},
+		},
+		{
+			name:  "unterminated placeholder is text",
+			src:   "${1:abc",
+			text:  "${1:abc",
+			stops: []snippetStop{final(7)},
+		},
+		{
+			name:  "lone dollar is text",
+			src:   "a $ b $",
+			text:  "a $ b $",
+			stops: []snippetStop{final(7)},
+		},
+		{
+			name:   "lines after the first are indented",
+			src:    "if {\n\t$0\n}",
+			indent: "  ",
+			text:   "if {\n  \t\n  }",
+			stops:  []snippetStop{{ranges: [][2]int{{8, 8}}, final: true}},
+		},
+		{
+			name: "placeholder containing its own stop",
+			src:  "${1:a$1}",
+			text: "a",
+			stops: []snippetStop{
+				{index: 1, ranges: [][2]int{{1, 1}, {0, 1}}},
+				final(1),
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := expandSnippet(parseSnippet(tt.src), vars, tt.indent)
+		if got.text != tt.text {
+			t.Errorf("%s: text = %q, want %q", tt.name, got.text, tt.text)
+		}
+		if !reflect.DeepEqual(got.stops, tt.stops) {
+			t.Errorf("%s: stops = %+v, want %+v", tt.name, got.stops, tt.stops)
+		}
+	}
+}
+
+func TestSnippetContextVariable(t *testing.T) {
+	ctx := snippetContext{
+		path:     "dir/main.go",
+		lang:     "python",
+		line:     4,
+		lineText: "  foo",
+		word:     "foo",
+		selected: "sel",
+	}
+	tests := []struct {
+		name, want string
+		known      bool
+	}{
+		{"TM_SELECTED_TEXT", "sel", true},
+		{"TM_CURRENT_LINE", "  foo", true},
+		{"TM_CURRENT_WORD", "foo", true},
+		{"TM_LINE_INDEX", "4", true},
+		{"TM_LINE_NUMBER", "5", true},
+		{"TM_FILENAME", "main.go", true},
+		{"TM_FILENAME_BASE", "main", true},
+		{"LINE_COMMENT", "#", true},
+		{"CLIPBOARD", "", true},
+		{"NOPE", "", false},
+	}
+	for _, tt := range tests {
+		got, known := ctx.variable(tt.name)
+		if got != tt.want || known != tt.known {
+			t.Errorf("variable(%q) = %q, %v; want %q, %v", tt.name, got, known, tt.want, tt.known)
+		}
+	}
+	uuid, _ := ctx.variable("UUID")
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(uuid) {
+		t.Errorf("UUID = %q, not a version 4 UUID", uuid)
+	}
+}
+
+func TestOffsetLineCol(t *testing.T) {
+	tests := []struct {
+		offset, line, col int
+	}{
+		{0, 0, 0},
+		{2, 0, 2},
+		{3, 1, 0},
+		{5, 1, 2},
+		{99, 2, 1},
+	}
+	for _, tt := range tests {
+		if line, col := offsetLineCol("aé\nbc\nd", tt.offset); line != tt.line || col != tt.col {
+			t.Errorf("offsetLineCol(%d) = %d, %d; want %d, %d", tt.offset, line, col, tt.line, tt.col)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"image"
+	"log"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/oligo/gvcode"
+	gvcolor "github.com/oligo/gvcode/color"
+	"github.com/oligo/gvcode/textstyle/decoration"
+)
+
+// snippetSource is the decoration source of the tab stops of the active snippet; the decorations
+// double as markers that keep track of where the stops are while the text changes.
+// snippetCurrentSource highlights the stop being filled in.
+const (
+	snippetSource        = "snippet"
+	snippetCurrentSource = "snippet-current"
+)
+
+// textMarker is a position in the editor that moves with the text around it.
+type textMarker interface{ Offset() int }
+
+// snippetRange is a range of the editor's text delimited by markers.
+type snippetRange struct {
+	start, end textMarker
+}
+
+func (r snippetRange) offsets() (int, int) {
+	return r.start.Offset(), r.end.Offset()
+}
+
+// sessionStop is a tab stop of the inserted snippet.
+type sessionStop struct {
+	ranges  []snippetRange // the first is selected, the others mirror it
+	choices []string
+	final   bool
+}
+
+// snippetSession is the snippet being filled in in an editor. Tab and Shift+Tab move between its
+// tab stops, typing in a stop updates its mirrors, and on a stop with choices Up and Down switch
+// between them. It ends at the final stop, on Escape, or when the caret leaves the snippet.
+type snippetSession struct {
+	editor *gvcode.Editor
+	theme  *theme.Theme
+	active bool
+	whole  snippetRange
+	stops  []sessionStop
+	// current indexes stops; choice is the current stop's choice shown.
+	current int
+	choice  int
+}
+
+// insert replaces the editor's selection with exp and starts filling it in.
+func (s *snippetSession) insert(ed *gvcode.Editor, th *theme.Theme, exp snippetExpansion) {
+	s.end()
+	start, end := ed.Selection()
+	start = min(start, end)
+	ed.Insert(exp.text)
+	if len(exp.stops) == 1 {
+		// Only the final stop: there is nothing to fill in.
+		stop := exp.stops[0].ranges[0]
+		ed.SetCaret(start+stop[0], start+stop[0])
+		return
+	}
+	s.editor, s.theme = ed, th
+	decos := []decoration.Decoration{{Source: snippetSource, Start: start, End: start + utf8.RuneCountInString(exp.text)}}
+	border := &decoration.Border{Color: gvcolor.MakeColor(th.Base.Text).MulAlpha(0x70)}
+	for _, stop := range exp.stops {
+		for _, r := range stop.ranges {
+			deco := decoration.Decoration{Source: snippetSource, Start: start + r[0], End: start + r[1]}
+			if !stop.final {
+				deco.Border = border
+			}
+			decos = append(decos, deco)
+		}
+	}
+	if err := ed.AddDecorations(decos...); err != nil {
+		log.Printf("snippet decorations: %v", err)
+		ed.ClearDecorations(snippetSource)
+		return
+	}
+	markers := func(d *decoration.Decoration) snippetRange {
+		start, end := d.Range()
+		return snippetRange{start: start, end: end}
+	}
+	s.whole = markers(&decos[0])
+	s.stops = make([]sessionStop, len(exp.stops))
+	i := 1
+	for k, stop := range exp.stops {
+		s.stops[k] = sessionStop{choices: stop.choices, final: stop.final}
+		for range stop.ranges {
+			s.stops[k].ranges = append(s.stops[k].ranges, markers(&decos[i]))
+			i++
+		}
+	}
+	s.active = true
+	s.current = -1
+	ed.RegisterCommand(s, key.Filter{Name: key.NameTab, Optional: key.ModShift},
+		func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			if evt.Modifiers.Contain(key.ModShift) {
+				s.move(max(s.current-1, 0))
+			} else {
+				s.move(s.current + 1)
+			}
+			return nil
+		})
+	ed.RegisterCommand(s, key.Filter{Name: key.NameEscape},
+		func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			s.end()
+			return nil
+		})
+	s.move(0)
+}
+
+// move selects the idx-th tab stop, or ends the session at the final one.
+func (s *snippetSession) move(idx int) {
+	if idx >= len(s.stops) {
+		s.end()
+		return
+	}
+	s.current = idx
+	stop := s.stops[idx]
+	start, end := stop.ranges[0].offsets()
+	s.editor.SetCaret(end, start)
+	if stop.final {
+		s.end()
+		return
+	}
+	s.highlight()
+	s.editor.RemoveCommands(&s.choice)
+	if len(stop.choices) == 0 {
+		return
+	}
+	value := s.editor.Text()
+	s.choice = max(slices.Index(stop.choices, string([]rune(value)[start:end])), 0)
+	choose := func(delta int) gvcode.CommandHandler {
+		return func(gtx layout.Context, evt key.Event) gvcode.EditorEvent {
+			s.choose((s.choice + delta + len(stop.choices)) % len(stop.choices))
+			return nil
+		}
+	}
+	s.editor.RegisterCommand(&s.choice, key.Filter{Name: key.NameUpArrow}, choose(-1))
+	s.editor.RegisterCommand(&s.choice, key.Filter{Name: key.NameDownArrow}, choose(1))
+}
+
+// choose replaces the current stop's text, and its mirrors', with its i-th choice.
+func (s *snippetSession) choose(i int) {
+	stop := s.stops[s.current]
+	s.choice = i
+	start, end := stop.ranges[0].offsets()
+	s.editor.SetCaret(start, end)
+	s.editor.Insert(stop.choices[i])
+	start, end = stop.ranges[0].offsets()
+	s.editor.SetCaret(end, start)
+	s.update(true)
+}
+
+// update follows the editor: the mirrors of the current stop copy what was typed in it, and the
+// session ends once the caret is outside the snippet. changed reports whether the text was edited.
+func (s *snippetSession) update(changed bool) {
+	if !s.active {
+		return
+	}
+	caretStart, caretEnd := s.editor.Selection()
+	if start, end := s.whole.offsets(); min(caretStart, caretEnd) < start || max(caretStart, caretEnd) > end {
+		s.end()
+		return
+	}
+	if changed {
+		s.mirror(s.editor.Text())
+		s.highlight()
+	}
+}
+
+// mirror copies the current stop's text to its other ranges.
+func (s *snippetSession) mirror(text string) {
+	stop := s.stops[s.current]
+	if len(stop.ranges) < 2 {
+		return
+	}
+	runes := []rune(text)
+	start, end := stop.ranges[0].offsets()
+	value := string(runes[start:end])
+	caretStart, caretEnd := s.editor.Selection()
+	relStart, relEnd := caretStart-start, caretEnd-start
+	for _, r := range stop.ranges[1:] {
+		start, end := r.offsets()
+		if string(runes[start:end]) == value {
+			continue
+		}
+		s.editor.SetCaret(start, end)
+		s.editor.Insert(value)
+	}
+	start, _ = stop.ranges[0].offsets()
+	s.editor.SetCaret(start+relStart, start+relEnd)
+}
+
+// highlight marks the current stop's ranges.
+func (s *snippetSession) highlight() {
+	s.editor.ClearDecorations(snippetCurrentSource)
+	background := &decoration.Background{Color: gvcolor.MakeColor(s.theme.Base.Text).MulAlpha(0x20)}
+	var decos []decoration.Decoration
+	for _, r := range s.stops[s.current].ranges {
+		if start, end := r.offsets(); start < end {
+			decos = append(decos, decoration.Decoration{Source: snippetCurrentSource, Start: start, End: end, Background: background})
+		}
+	}
+	if err := s.editor.AddDecorations(decos...); err != nil {
+		log.Printf("snippet decorations: %v", err)
+	}
+}
+
+// end leaves the snippet as it is and stops tracking it.
+func (s *snippetSession) end() {
+	if !s.active {
+		return
+	}
+	s.active = false
+	s.stops = nil
+	s.editor.ClearDecorations(snippetSource)
+	s.editor.ClearDecorations(snippetCurrentSource)
+	s.editor.RemoveCommands(s)
+	s.editor.RemoveCommands(&s.choice)
+}
+
+// Layout lists the choices of the current stop below it, the one shown highlighted.
+func (s *snippetSession) Layout(gtx layout.Context) layout.Dimensions {
+	if !s.active || len(s.stops[s.current].choices) == 0 {
+		return layout.Dimensions{}
+	}
+	th := s.theme
+	start, _ := s.stops[s.current].ranges[0].offsets()
+	line, col := offsetLineCol(s.editor.Text(), start)
+	_, pos := s.editor.ConvertPos(line, col)
+	s.editor.PaintOverlay(gtx, image.Pt(int(pos.X), int(pos.Y)), func(gtx layout.Context) layout.Dimensions {
+		gtx.Constraints.Min = image.Point{}
+		macro := op.Record(gtx.Ops)
+		dims := layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			children := make([]layout.FlexChild, len(s.stops[s.current].choices))
+			for i, choice := range s.stops[s.current].choices {
+				children[i] = layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Background{}.Layout(gtx,
+						func(gtx layout.Context) layout.Dimensions {
+							if i == s.choice {
+								fill := th.Material().ContrastBg
+								fill.A = 0x60
+								paint.FillShape(gtx.Ops, fill, clip.Rect{Max: gtx.Constraints.Min}.Op())
+							}
+							return layout.Dimensions{Size: gtx.Constraints.Min}
+						},
+						func(gtx layout.Context) layout.Dimensions {
+							return layout.Inset{Top: unit.Dp(2), Bottom: unit.Dp(2), Left: unit.Dp(6), Right: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+								lb := material.Label(th.Material(), unit.Sp(12), choice)
+								lb.Color = th.Base.Text
+								lb.MaxLines = 1
+								return lb.Layout(gtx)
+							})
+						},
+					)
+				})
+			}
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+		})
+		call := macro.Stop()
+		defer clip.UniformRRect(image.Rectangle{Max: dims.Size}, gtx.Dp(unit.Dp(4))).Push(gtx.Ops).Pop()
+		paint.Fill(gtx.Ops, th.Base.SurfaceHighlight)
+		call.Add(gtx.Ops)
+		return dims
+	})
+	return layout.Dimensions{}
+}
+
+// offsetLineCol returns the 0-based line and rune column of a rune offset in text.
+func offsetLineCol(text string, offset int) (int, int) {
+	runes := []rune(text)
+	offset = min(offset, len(runes))
+	before := string(runes[:offset])
+	line := strings.Count(before, "\n")
+	col := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:])
+	return line, col
+}
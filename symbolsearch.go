@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/chapar-rest/uikit/theme"
+	"github.com/mirzakhany/void/lsp"
+	"go.lsp.dev/protocol"
+)
+
+// symbolSearchCmdTag is the tag for the Ctrl+T / Cmd+T (go to symbol in workspace) command
+// registered with the editor.
+var symbolSearchCmdTag struct{}
+
+// symbolSearchDelay is how long the symbol search waits after a keystroke before querying the
+// servers.
+const symbolSearchDelay = 150 * time.Millisecond
+
+// symbolSearch is the Go to Symbol in Workspace overlay: it sends workspace/symbol to every
+// running language server as the query is typed and lists the merged results, best fuzzy match
+// first. Up/Down move the selection, Enter or a click opens the symbol, Escape closes it.
+type symbolSearch struct {
+	visible  bool
+	input    widget.Editor
+	results  []protocol.SymbolInformation
+	clicks   []widget.Clickable
+	selected int
+	list     widget.List
+	scrim    widget.Clickable
+	status   string // shown instead of the results, e.g. "Searching…"
+	timer    *time.Timer
+	// seq is bumped on every request so late responses are dropped.
+	seq    int
+	focus  bool
+	closed bool
+}
+
+// open shows the overlay with an empty query.
+func (d *symbolSearch) open() {
+	*d = symbolSearch{visible: true, focus: true, status: "Type to search symbols", seq: d.seq + 1}
+	d.input.SingleLine = true
+	d.input.Submit = true
+}
+
+// hide closes the overlay without opening anything.
+func (d *symbolSearch) hide() {
+	d.visible = false
+	d.results = nil
+	d.clicks = nil
+	d.seq++
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.closed = true
+}
+
+// scheduleSymbolSearch queries the servers for the current input after symbolSearchDelay.
+func (s *appState) scheduleSymbolSearch() {
+	d := &s.symbolSearch
+	d.seq++
+	seq := d.seq
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(symbolSearchDelay, func() {
+		s.runOnUI(func() {
+			if seq == d.seq {
+				s.searchSymbols(strings.TrimSpace(d.input.Text()))
+			}
+		})
+	})
+}
+
+// searchSymbols sends workspace/symbol for query to all running servers in the background and
+// shows the merged results ranked by how well their names match query.
+func (s *appState) searchSymbols(query string) {
+	d := &s.symbolSearch
+	if query == "" {
+		d.setResults(nil, "Type to search symbols")
+		return
+	}
+	d.seq++
+	seq := d.seq
+	d.status = "Searching…"
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspRequestTimeout)
+		defer cancel()
+		symbols, err := s.lspManager.WorkspaceSymbols(ctx, query)
+		status := ""
+		switch {
+		case errors.Is(err, lsp.ErrNoWorkspaceSymbolServer):
+			status = "No running language server can search symbols"
+		case err != nil:
+			log.Printf("[LSP] workspace/symbol failed for %q: %v", query, err)
+			if len(symbols) == 0 {
+				status = err.Error()
+			}
+		}
+		symbols = rankSymbols(query, symbols)
+		if status == "" && len(symbols) == 0 {
+			status = "No symbols found"
+		}
+		s.runOnUI(func() {
+			if seq == d.seq {
+				d.setResults(symbols, status)
+			}
+		})
+	}()
+}
+
+// setResults replaces the listed symbols.
+func (d *symbolSearch) setResults(symbols []protocol.SymbolInformation, status string) {
+	d.results = symbols
+	d.clicks = make([]widget.Clickable, len(symbols))
+	d.selected = 0
+	d.status = status
+	d.list.Position = layout.Position{}
+}
+
+// rankSymbols sorts symbols by how well their names fuzzy-match query and drops the ones that
+// do not match at all. Servers match loosely (e.g. by package path), so their own order is only
+// kept between equal scores.
+func rankSymbols(query string, symbols []protocol.SymbolInformation) []protocol.SymbolInformation {
+	type scored struct {
+		sym   protocol.SymbolInformation
+		score int
+	}
+	ranked := make([]scored, 0, len(symbols))
+	for _, sym := range symbols {
+		if score, _ := lsp.FuzzyMatch(query, sym.Name); score >= 0 {
+			ranked = append(ranked, scored{sym, score})
+		}
+	}
+	slices.SortStableFunc(ranked, func(a, b scored) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+		return len(a.sym.Name) - len(b.sym.Name)
+	})
+	result := make([]protocol.SymbolInformation, len(ranked))
+	for i, r := range ranked {
+		result[i] = r.sym
+	}
+	return result
+}
+
+// layoutSymbolSearch handles the overlay's input and draws it.
+func (s *appState) layoutSymbolSearch(gtx layout.Context) layout.Dimensions {
+	d := &s.symbolSearch
+	if !d.visible {
+		return layout.Dimensions{}
+	}
+	for {
+		ev, ok := gtx.Event(
+			key.Filter{Focus: &d.input, Name: key.NameUpArrow},
+			key.Filter{Focus: &d.input, Name: key.NameDownArrow},
+			key.Filter{Focus: &d.input, Name: key.NameEscape},
+		)
+		if !ok {
+			break
+		}
+		e, ok := ev.(key.Event)
+		if !ok || e.State != key.Press {
+			continue
+		}
+		switch e.Name {
+		case key.NameUpArrow:
+			d.selected = max(d.selected-1, 0)
+			d.list.ScrollTo(d.selected)
+		case key.NameDownArrow:
+			d.selected = max(min(d.selected+1, len(d.results)-1), 0)
+			d.list.ScrollTo(d.selected)
+		case key.NameEscape:
+			d.hide()
+			return layout.Dimensions{}
+		}
+	}
+	for {
+		ev, ok := d.input.Update(gtx)
+		if !ok {
+			break
+		}
+		switch ev.(type) {
+		case widget.ChangeEvent:
+			s.scheduleSymbolSearch()
+		case widget.SubmitEvent:
+			s.openSymbol(d.selected)
+			return layout.Dimensions{}
+		}
+	}
+	for i := range d.clicks {
+		if d.clicks[i].Clicked(gtx) {
+			s.openSymbol(i)
+			return layout.Dimensions{}
+		}
+	}
+	if d.scrim.Clicked(gtx) {
+		d.hide()
+		return layout.Dimensions{}
+	}
+	if d.focus {
+		d.focus = false
+		gtx.Execute(key.FocusCmd{Tag: &d.input})
+	}
+
+	th := s.theme
+	size := gtx.Constraints.Max
+	d.scrim.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Dimensions{Size: size}
+	})
+	layoutModal(gtx, th, d, unit.Dp(640), func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Inset{Left: unit.Dp(6), Right: unit.Dp(6), Top: unit.Dp(2), Bottom: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					ed := material.Editor(th.Material(), &d.input, "Go to symbol in workspace")
+					ed.Font = EditorFont()
+					ed.TextSize = unit.Sp(14)
+					ed.Color = th.Base.Text
+					ed.HintColor = th.Base.TextSubtle
+					return ed.Layout(gtx)
+				})
+			}),
+			layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+				if d.status != "" && len(d.results) == 0 {
+					return layout.Inset{Left: unit.Dp(6), Top: unit.Dp(2), Bottom: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+						lb := material.Label(th.Material(), unit.Sp(12), d.status)
+						lb.Color = th.Base.TextSubtle
+						return lb.Layout(gtx)
+					})
+				}
+				d.list.Axis = layout.Vertical
+				return material.List(th.Material(), &d.list).Layout(gtx, len(d.results), func(gtx layout.Context, i int) layout.Dimensions {
+					return d.layoutResult(gtx, th, i)
+				})
+			}),
+		)
+	})
+	return layout.Dimensions{Size: size}
+}
+
+// layoutResult draws a result row: the symbol's kind icon, name, container and location.
+func (d *symbolSearch) layoutResult(gtx layout.Context, th *theme.Theme, i int) layout.Dimensions {
+	sym := d.results[i]
+	path := projectPath(lsp.URIToPath(sym.Location.URI))
+	detail := fmt.Sprintf("%s:%d", path, sym.Location.Range.Start.Line+1)
+	if sym.ContainerName != "" {
+		detail = sym.ContainerName + " · " + detail
+	}
+	icon, iconColor := symbolKindIcon(th, sym.Kind)
+	return d.clicks[i].Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Background{}.Layout(gtx,
+			func(gtx layout.Context) layout.Dimensions {
+				if i == d.selected || d.clicks[i].Hovered() {
+					defer clip.UniformRRect(image.Rectangle{Max: gtx.Constraints.Min}, gtx.Dp(unit.Dp(4))).Push(gtx.Ops).Pop()
+					paint.Fill(gtx.Ops, th.Base.Surface)
+				}
+				return layout.Dimensions{Size: gtx.Constraints.Min}
+			},
+			func(gtx layout.Context) layout.Dimensions {
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return layout.Inset{Top: unit.Dp(4), Bottom: unit.Dp(4), Left: unit.Dp(6), Right: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							size := gtx.Dp(unit.Dp(14))
+							gtx.Constraints = layout.Exact(image.Pt(size, size))
+							return icon.Layout(gtx, iconColor)
+						}),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							return layout.Inset{Left: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+								lb := material.Label(th.Material(), unit.Sp(13), sym.Name)
+								lb.Color = th.Base.Text
+								lb.MaxLines = 1
+								return lb.Layout(gtx)
+							})
+						}),
+						layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+							return layout.Inset{Left: unit.Dp(10)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+								lb := material.Label(th.Material(), unit.Sp(11), detail)
+								lb.Color = th.Base.TextSubtle
+								lb.MaxLines = 1
+								return lb.Layout(gtx)
+							})
+						}),
+					)
+				})
+			},
+		)
+	})
+}
+
+// openSymbol closes the overlay and opens the i-th result in a tab at its range.
+func (s *appState) openSymbol(i int) {
+	d := &s.symbolSearch
+	if i < 0 || i >= len(d.results) {
+		return
+	}
+	loc := d.results[i].Location
+	d.hide()
+	s.openLocation(loc)
+}
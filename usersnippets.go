@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gioui.org/io/key"
+	"github.com/mirzakhany/void/lsp"
+	"github.com/oligo/gvcode"
+)
+
+// userSnippet is a snippet from a user snippet file.
+type userSnippet struct {
+	name        string
+	prefixes    []string
+	body        string
+	description string
+	scope       []string // language IDs the snippet is for; all if empty
+}
+
+// stringList is a JSON string or array of strings.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+// userSnippetEntry is a snippet in a snippet file, in VS Code's format. The body's lines are
+// joined with newlines; scope is a comma-separated list of language IDs.
+type userSnippetEntry struct {
+	Prefix      stringList `json:"prefix"`
+	Body        stringList `json:"body"`
+	Description string     `json:"description"`
+	Scope       string     `json:"scope"`
+}
+
+// snippetDirs returns the directories user snippets are loaded from: .void/snippets in the
+// project, then void/snippets in the user's config directory (~/.config/void/snippets on Linux).
+func snippetDirs(projectRoot string) []string {
+	dirs := []string{filepath.Join(projectRoot, ".void", "snippets")}
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "void", "snippets"))
+	}
+	return dirs
+}
+
+// snippetCheckInterval is how often, at most, the snippet files are checked for changes.
+const snippetCheckInterval = 2 * time.Second
+
+// userSnippets holds the snippets of the *.json files in snippetDirs. A file named after a
+// language ID (go.json, python.json) holds that language's snippets; the snippets in
+// global.json are for every language, or for the ones listed in their scope. The files are
+// read in the background when the app starts, and read again when they change: completion
+// checks them at most every snippetCheckInterval, and saving one in the editor checks at once.
+type userSnippets struct {
+	mu       sync.Mutex
+	root     string
+	stamp    string // names, sizes and modification times of the files read
+	snippets []userSnippet
+	checked  time.Time // when the files were last checked
+	checking bool      // a check is running
+}
+
+// load reads the snippet files of the project at root in the background.
+func (u *userSnippets) load(s *appState, root string) {
+	u.mu.Lock()
+	u.root = root
+	u.mu.Unlock()
+	u.check(s)
+}
+
+// forLanguage returns the snippets for a language ID as last read. If the files have not been
+// checked for a while, a check is started for later calls.
+func (u *userSnippets) forLanguage(s *appState, lang string) []userSnippet {
+	u.mu.Lock()
+	snippets := u.snippets
+	stale := time.Since(u.checked) >= snippetCheckInterval
+	u.mu.Unlock()
+	if stale {
+		u.check(s)
+	}
+	var result []userSnippet
+	for _, snip := range snippets {
+		if len(snip.scope) == 0 || slices.Contains(snip.scope, lang) {
+			result = append(result, snip)
+		}
+	}
+	return result
+}
+
+// check reads the snippet files again in the background if any was added, removed or modified
+// since they were read last, unless a check is already running. Files that cannot be parsed are
+// reported and skipped.
+func (u *userSnippets) check(s *appState) {
+	u.mu.Lock()
+	if u.checking {
+		u.mu.Unlock()
+		return
+	}
+	u.checking = true
+	root, oldStamp := u.root, u.stamp
+	u.mu.Unlock()
+	go func() {
+		var files []string
+		var stamp strings.Builder
+		for _, dir := range snippetDirs(root) {
+			matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+			for _, path := range matches {
+				info, err := os.Stat(path)
+				if err != nil {
+					continue
+				}
+				files = append(files, path)
+				fmt.Fprintf(&stamp, "%s:%d:%d\n", path, info.Size(), info.ModTime().UnixNano())
+			}
+		}
+		changed := stamp.String() != oldStamp
+		var snippets []userSnippet
+		if changed {
+			for _, path := range files {
+				fileSnippets, err := readSnippetFile(path)
+				if err != nil {
+					log.Printf("snippets %q: %v", path, err)
+					s.notify(fmt.Sprintf("Snippets %s: %v", filepath.Base(path), err))
+					continue
+				}
+				snippets = append(snippets, fileSnippets...)
+			}
+		}
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		if changed {
+			u.stamp, u.snippets = stamp.String(), snippets
+		}
+		u.checked, u.checking = time.Now(), false
+	}()
+}
+
+// isSnippetFile reports whether path is one of the files in snippetDirs(root).
+func isSnippetFile(root, path string) bool {
+	if filepath.Ext(path) != ".json" {
+		return false
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	for _, d := range snippetDirs(root) {
+		if abs, err := filepath.Abs(d); err == nil && abs == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// readSnippetFile parses a snippet file, in the order of the snippets' names.
+func readSnippetFile(path string) ([]userSnippet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries map[string]userSnippetEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	var fileScope []string
+	if name := strings.TrimSuffix(filepath.Base(path), ".json"); name != "global" {
+		fileScope = []string{name}
+	}
+	snippets := make([]userSnippet, 0, len(entries))
+	for name, e := range entries {
+		if len(e.Prefix) == 0 || len(e.Body) == 0 {
+			continue
+		}
+		snip := userSnippet{
+			name:        name,
+			prefixes:    e.Prefix,
+			body:        strings.Join(e.Body, "\n"),
+			description: e.Description,
+			scope:       fileScope,
+		}
+		if fileScope == nil && e.Scope != "" {
+			for _, lang := range strings.Split(e.Scope, ",") {
+				snip.scope = append(snip.scope, strings.TrimSpace(lang))
+			}
+		}
+		snippets = append(snippets, snip)
+	}
+	slices.SortFunc(snippets, func(a, b userSnippet) int { return strings.Compare(a.name, b.name) })
+	return snippets, nil
+}
+
+// snippetCompletor adds the user snippets of the document's language to the candidates of the
+// language server's completor, or of the project completor when there is no server. A snippet
+// candidate replaces the word before the caret with the snippet's body.
+type snippetCompletor struct {
+	lsp      *lsp.Completor    // may be nil
+	project  *projectCompletor // the fallback without lsp; may be nil
+	editor   *gvcode.Editor
+	snippets func() []userSnippet
+	ranker   *lsp.CompletionRanker
+	// caret is the caret's rune offset when completion was last requested; shown are the
+	// candidates FilterAndRank returned last.
+	caret int
+	shown []gvcode.CompletionCandidate
+}
+
+// Trigger implements gvcode.Completor with the language server's trigger, else the project
+// completor's, or Ctrl+Space.
+func (c *snippetCompletor) Trigger() gvcode.Trigger {
+	if c.lsp != nil {
+		return c.lsp.Trigger()
+	}
+	if c.project != nil {
+		return c.project.Trigger()
+	}
+	return gvcode.Trigger{
+		KeyBinding: struct {
+			Name      key.Name
+			Modifiers key.Modifiers
+		}{
+			Name: key.NameSpace, Modifiers: key.ModShortcut,
+		},
+	}
+}
+
+// Suggest implements gvcode.Completor. Snippets are not offered after a trigger character like
+// "." that is not part of a word.
+func (c *snippetCompletor) Suggest(ctx gvcode.CompletionContext) []gvcode.CompletionCandidate {
+	var candidates []gvcode.CompletionCandidate
+	if c.lsp != nil {
+		candidates = c.lsp.Suggest(ctx)
+	} else if c.project != nil {
+		candidates = c.project.Suggest(ctx)
+	}
+	c.caret = ctx.Position.Runes
+	if r, _ := utf8.DecodeRuneInString(ctx.Input); ctx.Input != "" && !isIdentRune(r) {
+		return candidates
+	}
+	start, _ := wordBounds([]rune(c.editor.Text()), c.caret)
+	start = min(start, c.caret)
+	editRange := gvcode.EditRange{Start: ctx.Position, End: ctx.Position}
+	editRange.Start.Runes = start
+	editRange.Start.Column -= c.caret - start
+	for _, snip := range c.snippets() {
+		desc := snip.description
+		if desc == "" {
+			desc = snip.name
+		}
+		for _, prefix := range snip.prefixes {
+			candidates = append(candidates, gvcode.CompletionCandidate{
+				Label: prefix,
+				TextEdit: gvcode.TextEdit{
+					NewText:   snip.body,
+					EditRange: editRange,
+				},
+				Description: desc,
+				Kind:        "snippet",
+				TextFormat:  "Snippet",
+			})
+		}
+	}
+	return candidates
+}
+
+// FilterAndRank implements gvcode.Completor. Without a language server the candidates are
+// ranked here, and their edit ranges are extended over what was typed since the request.
+func (c *snippetCompletor) FilterAndRank(pattern string, candidates []gvcode.CompletionCandidate) []gvcode.CompletionCandidate {
+	if c.lsp != nil {
+		c.shown = c.lsp.FilterAndRank(pattern, candidates)
+		return c.shown
+	}
+	keys := make([]lsp.RankKey, len(candidates))
+	for i, cand := range candidates {
+		keys[i] = lsp.RankKey{Label: cand.Label}
+	}
+	line, col := c.editor.CaretPos()
+	caret, _ := c.editor.ConvertPos(line, col)
+	typed := max(caret-c.caret, 0)
+	c.shown = c.shown[:0]
+	for _, i := range c.ranker.Rank(pattern, keys) {
+		cand := candidates[i]
+		// The project's candidates leave the range to the completion's prefix.
+		if end := &cand.TextEdit.EditRange.End; cand.TextEdit.EditRange != (gvcode.EditRange{}) && end.Runes >= c.caret {
+			end.Runes += typed
+			end.Column += typed
+		}
+		c.shown = append(c.shown, cand)
+	}
+	return c.shown
+}
+
+// candidate returns the idx-th candidate FilterAndRank returned last.
+func (c *snippetCompletor) candidate(idx int) (gvcode.CompletionCandidate, bool) {
+	if idx < 0 || idx >= len(c.shown) {
+		return gvcode.CompletionCandidate{}, false
+	}
+	return c.shown[idx], true
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/mirzakhany/void/lsp"
+	"github.com/oligo/gvcode"
+	"go.lsp.dev/protocol"
+)
+
+// fileEdits is the part of a WorkspaceEdit that applies to one file.
+type fileEdits struct {
+	path    string // project path, the key in appState.openFiles
+	uri     protocol.DocumentURI
+	version *int32 // document version the edits were computed against, if the server says
+	edits   []protocol.TextEdit
+}
+
+// workspaceEditFiles flattens edit into per-file edits sorted by path. documentChanges
+// take precedence over changes, as the protocol specifies.
+func workspaceEditFiles(edit protocol.WorkspaceEdit) []fileEdits {
+	var files []fileEdits
+	if len(edit.DocumentChanges) > 0 {
+		for _, dc := range edit.DocumentChanges {
+			files = append(files, fileEdits{
+				path:    projectPath(lsp.URIToPath(dc.TextDocument.URI)),
+				uri:     dc.TextDocument.URI,
+				version: dc.TextDocument.Version,
+				edits:   dc.Edits,
+			})
+		}
+	} else {
+		for uri, edits := range edit.Changes {
+			files = append(files, fileEdits{path: projectPath(lsp.URIToPath(uri)), uri: uri, edits: edits})
+		}
+	}
+	slices.SortStableFunc(files, func(a, b fileEdits) int { return cmp.Compare(a.path, b.path) })
+	return files
+}
+
+// applyWorkspaceEdit applies edit to the workspace: files open in a tab are edited in their
+// buffer (so the change can be undone and saved as usual) and synced to their server; other
+// files are rewritten on disk. Every file is checked and read before anything is changed, so an
+// edit that cannot be applied leaves the workspace as it was. It must be called on the UI
+// goroutine.
+func (s *appState) applyWorkspaceEdit(edit protocol.WorkspaceEdit) error {
+	files := workspaceEditFiles(edit)
+	// Refuse the whole edit if an open document moved on since the server computed it.
+	for _, f := range files {
+		if fv, ok := s.openFiles[f.path]; ok && f.version != nil && fv.LSPClient != nil && *f.version != fv.DocVersion {
+			return fmt.Errorf("%s changed (version %d, edit is for %d)", f.path, fv.DocVersion, *f.version)
+		}
+	}
+	// Compute the new contents of files that are not open; refuse the edit if one cannot be read.
+	type diskEdit struct {
+		path string
+		text string
+		perm os.FileMode
+	}
+	var disk []diskEdit
+	for _, f := range files {
+		if _, ok := s.openFiles[f.path]; ok || len(f.edits) == 0 {
+			continue
+		}
+		info, err := os.Stat(f.path)
+		if err != nil {
+			return fmt.Errorf("apply workspace edit: %v", err)
+		}
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return fmt.Errorf("apply workspace edit: %v", err)
+		}
+		disk = append(disk, diskEdit{f.path, lsp.ApplyTextEdits(string(data), f.edits), info.Mode().Perm()})
+	}
+	var errs []error
+	for _, d := range disk {
+		if err := os.WriteFile(d.path, []byte(d.text), d.perm); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, f := range files {
+		fv, ok := s.openFiles[f.path]
+		if !ok || len(f.edits) == 0 {
+			continue
+		}
+		applyTextEdits(fv.Editor, f.edits)
+		if fv.OnChange != nil {
+			fv.OnChange(fv.Editor.Text())
+		}
+		fv.syncLSP()
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("apply workspace edit: %v", errs)
+	}
+	return nil
+}
+
+// applyServerEdit is the lsp.ApplyEditHandler for server-initiated workspace/applyEdit. It is
+// called on a connection goroutine and waits for the edit to be applied on the UI goroutine.
+func (s *appState) applyServerEdit(edit protocol.WorkspaceEdit) bool {
+	done := make(chan bool, 1)
+	s.runOnUI(func() {
+		err := s.applyWorkspaceEdit(edit)
+		if err != nil {
+			log.Printf("[LSP] workspace/applyEdit: %v", err)
+		}
+		done <- err == nil
+	})
+	select {
+	case ok := <-done:
+		return ok
+	case <-time.After(lspRequestTimeout):
+		log.Printf("[LSP] workspace/applyEdit: timed out waiting for the UI")
+		return false
+	}
+}
+
+// applyTextEdits applies LSP text edits to ed. Ranges refer to the text before any of the edits;
+// they are applied back to front, in the order of lsp.TextEditSpans. The caret and selection keep their place
+// relative to the surrounding text.
+func applyTextEdits(ed *gvcode.Editor, edits []protocol.TextEdit) {
+	spans := lsp.TextEditSpans(ed.Text(), edits)
+	caret, selEnd := ed.Selection()
+	shift := func(pos int, sp lsp.TextEditSpan) int {
+		switch {
+		case pos >= sp.End:
+			return pos + len([]rune(sp.NewText)) - (sp.End - sp.Start)
+		case pos > sp.Start:
+			return sp.Start
+		}
+		return pos
+	}
+	for i := len(spans) - 1; i >= 0; i-- {
+		sp := spans[i]
+		ed.ReplaceAll([]gvcode.TextRange{{Start: sp.Start, End: sp.End}}, sp.NewText)
+		caret, selEnd = shift(caret, sp), shift(selEnd, sp)
+	}
+	if len(spans) > 0 {
+		ed.SetCaret(caret, selEnd)
+	}
+}
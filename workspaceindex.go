@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+const (
+	// maxIndexedFileSize is the size above which a file is not indexed.
+	maxIndexedFileSize = 1 << 20
+	// maxIndexedFiles bounds how many files of the project are indexed.
+	maxIndexedFiles = 5000
+	// minIndexedIdentLen is the length below which identifiers are not worth completing.
+	minIndexedIdentLen = 3
+)
+
+// fileIdents are the identifiers of an indexed file. members maps a Go package name to its
+// exported identifiers and a Go type name to its fields and methods.
+type fileIdents struct {
+	idents  []string
+	members map[string][]string
+}
+
+// workspaceIndex holds the identifiers of the project's files for projectCompletor, the
+// completion of files that have no language server. It is built in the background when the app
+// starts and a file is indexed again when it is saved. Go files are parsed with go/parser so
+// that package and type members can be completed after a "."; other files contribute the names
+// chroma finds in them.
+type workspaceIndex struct {
+	mu     sync.Mutex
+	root   string
+	ignore *gitignore            // the rules of the project's .gitignore files, set once built
+	files  map[string]fileIdents // clean relative path -> identifiers
+	// index and memberIndex merge files; they are rebuilt by snapshot when dirty.
+	dirty       bool
+	index       []string
+	memberIndex map[string][]string
+}
+
+// build indexes the project at root in the background. Directories in fileTreeIgnoreList and
+// paths excluded by the project's .gitignore files are skipped.
+func (w *workspaceIndex) build(root string) {
+	w.mu.Lock()
+	w.root = root
+	w.mu.Unlock()
+	go func() {
+		var ignore gitignore
+		files := 0
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, path)
+			if rel != "." && (slices.Contains(fileTreeIgnoreList, d.Name()) || ignore.ignored(rel, d.IsDir())) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				ignore.load(root, rel)
+				return nil
+			}
+			if files >= maxIndexedFiles {
+				return filepath.SkipAll
+			}
+			if w.update(path) {
+				files++
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("index %q: %v", root, err)
+		}
+		log.Printf("indexed %d files of %q", files, root)
+		w.mu.Lock()
+		w.ignore = &ignore
+		w.mu.Unlock()
+	}()
+}
+
+// refresh indexes a saved file again unless the project ignores it. Files saved before the
+// index is built are left to build.
+func (w *workspaceIndex) refresh(path string) {
+	w.mu.Lock()
+	ignore, root := w.ignore, w.root
+	w.mu.Unlock()
+	if ignore == nil {
+		return
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return
+	}
+	// Check the file's directories as build walked them, then the file.
+	elems := strings.Split(rel, string(filepath.Separator))
+	for i, elem := range elems {
+		isDir := i < len(elems)-1
+		if slices.Contains(fileTreeIgnoreList, elem) || ignore.ignored(filepath.Join(elems[:i+1]...), isDir) {
+			return
+		}
+	}
+	w.update(path)
+}
+
+// update indexes the file at path again, or drops it if it can no longer be read. It reports
+// whether the file was indexed.
+func (w *workspaceIndex) update(path string) bool {
+	data, err := os.ReadFile(path)
+	var idents fileIdents
+	ok := err == nil && len(data) <= maxIndexedFileSize && isTextContent(data)
+	if ok {
+		idents, ok = extractIdents(path, data)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.files == nil {
+		w.files = make(map[string]fileIdents)
+	}
+	key := filepath.Clean(path)
+	if ok {
+		w.files[key] = idents
+	} else {
+		delete(w.files, key)
+	}
+	w.dirty = true
+	return ok
+}
+
+// snapshot returns the identifiers and members of all indexed files. The results are shared and
+// must not be modified.
+func (w *workspaceIndex) snapshot() ([]string, map[string][]string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.dirty {
+		return w.index, w.memberIndex
+	}
+	seen := make(map[string]bool)
+	index := make([]string, 0)
+	memberIndex := make(map[string][]string)
+	for _, f := range w.files {
+		for _, id := range f.idents {
+			if !seen[id] {
+				seen[id] = true
+				index = append(index, id)
+			}
+		}
+		for name, members := range f.members {
+			memberIndex[name] = append(memberIndex[name], members...)
+		}
+	}
+	slices.Sort(index)
+	for name, members := range memberIndex {
+		slices.Sort(members)
+		memberIndex[name] = slices.Compact(members)
+	}
+	w.index, w.memberIndex, w.dirty = index, memberIndex, false
+	return index, memberIndex
+}
+
+// isTextContent reports whether data looks like text rather than a binary file.
+func isTextContent(data []byte) bool {
+	head := data[:min(len(data), 8000)]
+	return !bytes.ContainsRune(head, 0) && utf8.Valid(head[:max(len(head)-utf8.UTFMax, 0)])
+}
+
+// extractIdents returns the identifiers of a file, from its Go syntax tree if it is a Go file
+// that parses, else from its chroma tokens. It reports false for files chroma has no lexer for.
+func extractIdents(path string, data []byte) (fileIdents, bool) {
+	if filepath.Ext(path) == ".go" {
+		if f, err := parser.ParseFile(token.NewFileSet(), path, data, parser.SkipObjectResolution); err == nil {
+			return goIdents(f), true
+		}
+	}
+	lexer := lexers.Match(filepath.Base(path))
+	if lexer == nil {
+		return fileIdents{}, false
+	}
+	it, err := chroma.Coalesce(lexer).Tokenise(nil, string(data))
+	if err != nil {
+		return fileIdents{}, false
+	}
+	seen := make(map[string]bool)
+	var idents fileIdents
+	for t := it(); t != chroma.EOF; t = it() {
+		if t.Type.InCategory(chroma.Name) && utf8.RuneCountInString(t.Value) >= minIndexedIdentLen && !seen[t.Value] {
+			seen[t.Value] = true
+			idents.idents = append(idents.idents, t.Value)
+		}
+	}
+	return idents, true
+}
+
+// goIdents collects the identifiers declared in a Go file, and the members of its package and
+// types: the package name maps to its exported declarations, a type name to its fields and
+// methods.
+func goIdents(f *ast.File) fileIdents {
+	seen := make(map[string]bool)
+	idents := fileIdents{members: make(map[string][]string)}
+	pkg := f.Name.Name
+	add := func(owner string, id *ast.Ident) {
+		if id == nil || id.Name == "_" {
+			return
+		}
+		if owner != "" {
+			idents.members[owner] = append(idents.members[owner], id.Name)
+		}
+		if utf8.RuneCountInString(id.Name) >= minIndexedIdentLen && !seen[id.Name] {
+			seen[id.Name] = true
+			idents.idents = append(idents.idents, id.Name)
+		}
+	}
+	exported := func(id *ast.Ident) string {
+		if id.IsExported() {
+			return pkg
+		}
+		return ""
+	}
+	// Package-level constants and variables are members of the package.
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && (gen.Tok == token.CONST || gen.Tok == token.VAR) {
+			for _, spec := range gen.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					if name.IsExported() {
+						idents.members[pkg] = append(idents.members[pkg], name.Name)
+					}
+				}
+			}
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Recv != nil && len(n.Recv.List) > 0 {
+				add(receiverTypeName(n.Recv.List[0].Type), n.Name)
+			} else {
+				add(exported(n.Name), n.Name)
+			}
+		case *ast.TypeSpec:
+			add(exported(n.Name), n.Name)
+			if st, ok := n.Type.(*ast.StructType); ok {
+				for _, field := range st.Fields.List {
+					for _, name := range field.Names {
+						add(n.Name.Name, name)
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			for _, name := range n.Names {
+				add("", name)
+			}
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				for _, lhs := range n.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok {
+						add("", id)
+					}
+				}
+			}
+		case *ast.Field:
+			for _, name := range n.Names {
+				add("", name)
+			}
+		}
+		return true
+	})
+	return idents
+}
+
+// receiverTypeName returns the name of a method's receiver type, without pointer or type
+// parameters.
+func receiverTypeName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}